@@ -0,0 +1,54 @@
+package cache
+
+import "sort"
+
+// KeyCount a key and the number of times its data has been read, see TopKeys
+type KeyCount[K comparable] struct {
+	Key   K
+	Count int64
+}
+
+// TopKeys get the n most accessed keys ordered from the most accessed, n less than or equal to 0 means all keys
+// Only reads that find live data are counted, expired data that has not been cleaned up is skipped
+// It returns nil if WithAccessTracking is not set, it scans all data, so it is O(n log n)
+func (c *mapCache[K, E]) TopKeys(n int) []KeyCount[K] {
+	return c.rankKeys(n, true)
+}
+
+// BottomKeys get the n least accessed keys ordered from the least accessed, n less than or equal to 0 means all keys
+// Only reads that find live data are counted, expired data that has not been cleaned up is skipped
+// It returns nil if WithAccessTracking is not set, it scans all data, so it is O(n log n)
+func (c *mapCache[K, E]) BottomKeys(n int) []KeyCount[K] {
+	return c.rankKeys(n, false)
+}
+
+// get the access counts of the live data, ranked by rankCounts
+func (c *mapCache[K, E]) rankKeys(n int, most bool) []KeyCount[K] {
+	if !c.trackAccess {
+		return nil
+	}
+	c.mu.RLock()
+	res := make([]KeyCount[K], 0, len(c.items))
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) {
+			res = append(res, KeyCount[K]{k, v.hits})
+		}
+	}
+	c.mu.RUnlock()
+	return rankCounts(res, n, most)
+}
+
+// sort the counts from the most or the least accessed and keep the first n
+func rankCounts[K comparable](counts []KeyCount[K], n int, most bool) []KeyCount[K] {
+	sort.SliceStable(counts, func(i, j int) bool {
+		if most {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Count < counts[j].Count
+	})
+	if n > 0 && n < len(counts) {
+		counts = counts[:n]
+	}
+	return counts
+}
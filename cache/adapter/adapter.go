@@ -0,0 +1,72 @@
+// Package adapter wrap the caches of the cache package in a minimal Cache interface with context,
+// so that they can be swapped with other cache implementations such as redis behind the same interface
+package adapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/lomtom/go-utils/cache"
+)
+
+// Cache a minimal cache interface shared by cache implementations
+type Cache[E any] interface {
+	// Get get data, it returns an error wrapping cache.ErrKeyNotFound if the data does not exist or expires
+	Get(ctx context.Context, key string) (E, error)
+	// Set set data with ttl, a ttl of 0 means the default expiration time, and a negative ttl means never expire
+	Set(ctx context.Context, key string, value E, ttl time.Duration) error
+	// Delete delete data, deleting data that does not exist is not an error
+	Delete(ctx context.Context, key string) error
+	// Clear remove all data
+	Clear(ctx context.Context) error
+}
+
+// Adapter implement Cache by forwarding to a cache of the cache package
+// The cache works in memory, so ctx is only checked before each operation and it returns ctx.Err() if ctx is done
+type Adapter[E any] struct {
+	cache cache.MapInterface[E]
+}
+
+// New create an adapter of c
+func New[E any](c cache.MapInterface[E]) *Adapter[E] {
+	return &Adapter[E]{c}
+}
+
+// Unwrap get the underlying cache, for the operations that Cache does not have
+func (a *Adapter[E]) Unwrap() cache.MapInterface[E] {
+	return a.cache
+}
+
+func (a *Adapter[E]) Get(ctx context.Context, key string) (E, error) {
+	if err := ctx.Err(); err != nil {
+		var zero E
+		return zero, err
+	}
+	return a.cache.MustGet(key)
+}
+
+func (a *Adapter[E]) Set(ctx context.Context, key string, value E, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.cache.SetWithTTL(key, value, ttl)
+	return nil
+}
+
+func (a *Adapter[E]) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.cache.Delete(key)
+	return nil
+}
+
+func (a *Adapter[E]) Clear(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.cache.Clear()
+	return nil
+}
+
+var _ Cache[int] = (*Adapter[int])(nil)
@@ -1,265 +1,1304 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"os"
 	"runtime"
 	"sync"
 	"time"
 )
 
 type MapCache[E any] struct {
-	*mapCache[E]
+	*mapCache[string, E]
 }
 
-type mapCache[E any] struct {
-	items  map[string]*Item[E] // Cache data items are stored in the map
-	mu     sync.RWMutex        // Read write lock
-	stopGc chan bool
-	isGc   bool
+// KeyMapCache the same as MapCache, but the key can be of any comparable type
+type KeyMapCache[K comparable, E any] struct {
+	*mapCache[K, E]
+}
+
+type mapCache[K comparable, E any] struct {
+	items map[K]*Item[E] // Cache data items are stored in the map
+	mu    sync.RWMutex   // Read write lock
+	// Order in which data is evicted, nil if neither the maximum number nor the maximum size of data is set
+	policy EvictionPolicy
+	sizer  func(E) int64 // Approximate size of data, nil means each data counts as 1
+	cost   func(E) int64 // Cost of recomputing data, nil means data is evicted in the order of the eviction policy
+	// Deep copy of the data on set and get, nil means the data is shared by reference
+	copier func(E) E
+	// Compress and decompress the stored data, nil if WithValueCompression is not set
+	compress   func(E) E
+	decompress func(E) E
+	// Equality of the data, Set does nothing if the data is equal to the data that exists, nil if WithDedupe is not set
+	dedupe func(a, b E) bool
+	// Load the data on a miss, nil if no loader is set
+	loader func(key K) (E, time.Duration, error)
+	bytes  int64 // Total size of data
+	// Called when data leaves the cache, evicted holds the data removed while holding the lock
+	onEvicted func(key K, value E, reason EvictionReason)
+	evicted   []evictedItem[K, E]
+	stats     *cacheStats               // nil if statistics are not enabled
+	misses    map[K]*Item[struct{}]     // Keys known to be absent, set by SetMiss
+	tags      map[string]map[K]struct{} // Keys of the data carrying each tag, set by SetWithTags
+	waiters   map[K][]chan struct{}     // Channels of WaitGet closed when the data of the key is set
+	// Changes of the data, nil if events are not enabled, droppedEvents counts the events dropped when it is full
+	events        chan CacheEvent[K, E]
+	droppedEvents int64
+	flight        flightGroup[K, E]  // Loads by the loader set by WithLoader
+	computes      flightGroup[K, E]  // Computations started by GetOrComputeCtx, kept apart from the loads
+	refreshes     flightGroup[K, E]  // Background reloads started by WithRefreshAhead
+	loadFailures  map[K]*loadFailure // Keys whose loader failed, set by WithServeStaleOnError
+	computeLocks  keyLocks[K]        // Locks of the keys being computed by GetOrCompute
+	stopGc        chan bool          // closed to stop the running gc loop
+	gcDone        chan struct{}      // closed by the gc loop after it exits
+	isGc          bool
+	expiries      expiryHeap[K] // Expiration times of the data, only used by the adaptive gc
+	gcWake        chan struct{} // Wake the adaptive gc loop up when data expires before all other data
+	// closed to stop the backup goroutine, and closed by it after it exits
+	stopPersistence chan struct{}
+	persistenceDone chan struct{}
+	persistMu       sync.Mutex // serializes writes of the persistence file
+	wal             *os.File   // write-ahead log, nil if it is not enabled
+	closed          bool
+	closing         chan struct{}       // closed by Close to stop watching the context set by WithContext
+	overflow        overflowStore[K, E] // Cold tier that takes the evicted data, nil if it is not a TieredCache
 	options
 }
 
 // NewMapCache create a cache with mapCache
 func NewMapCache[E any](opts ...CreateOptionFunc) (MapInterface[E], error) {
+	c, err := newMapCache[E](opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newMapCache[E any](opts ...CreateOptionFunc) (*MapCache[E], error) {
 	exp := newOption()
 	for _, opt := range opts {
 		opt(&exp)
 	}
-	res := &mapCache[E]{
+	res, err := createMapCache[string, E](exp)
+	if err != nil {
+		return nil, err
+	}
+	return wrapMapCache(res), nil
+}
+
+// wrap a mapCache, it is closed when the MapCache is garbage collected
+func wrapMapCache[E any](res *mapCache[string, E]) *MapCache[E] {
+	c := &MapCache[E]{
+		res,
+	}
+	runtime.SetFinalizer(c, func(m *MapCache[E]) {
+		_ = m.Close()
+	})
+	return c
+}
+
+// NewKeyMapCache create a cache with mapCache, the key can be of any comparable type
+// When persistence is enabled with JSONCodec, the key must be a string, an integer or implement encoding.TextMarshaler,
+// GobCodec supports any comparable key
+func NewKeyMapCache[K comparable, E any](opts ...CreateOptionFunc) (KeyMapInterface[K, E], error) {
+	exp := newOption()
+	for _, opt := range opts {
+		opt(&exp)
+	}
+	res, err := createMapCache[K, E](exp)
+	if err != nil {
+		return nil, err
+	}
+	c := &KeyMapCache[K, E]{
+		res,
+	}
+	runtime.SetFinalizer(c, func(m *KeyMapCache[K, E]) {
+		_ = m.Close()
+	})
+	return c, nil
+}
+
+// create a mapCache with the assembled options
+func createMapCache[K comparable, E any](exp options) (*mapCache[K, E], error) {
+	if err := exp.validate(); err != nil {
+		return nil, err
+	}
+	if !exp.gcIntervalSet && exp.expiration > 0 && exp.expiration < exp.gcInterval {
+		exp.gcInterval = exp.expiration
+	}
+	res := &mapCache[K, E]{
+		items:   make(map[K]*Item[E], exp.initialCapacity),
 		options: exp,
-		stopGc:  make(chan bool),
 	}
-	if exp.expiration != DefaultExpiration {
-		// start gc
-		_ = res.StartGc()
+	if exp.onEvicted != nil {
+		onEvicted, ok := exp.onEvicted.(func(K, E, EvictionReason))
+		if !ok {
+			return nil, fmt.Errorf("the type of the eviction callback %T does not match the cache", exp.onEvicted)
+		}
+		res.onEvicted = onEvicted
+	}
+	if exp.sizer != nil {
+		sizer, ok := exp.sizer.(func(E) int64)
+		if !ok {
+			return nil, fmt.Errorf("the type of the sizer %T does not match the cache", exp.sizer)
+		}
+		res.sizer = sizer
+	}
+	if exp.cost != nil {
+		cost, ok := exp.cost.(func(E) int64)
+		if !ok {
+			return nil, fmt.Errorf("the type of the cost function %T does not match the cache", exp.cost)
+		}
+		res.cost = cost
+	}
+	if exp.loader != nil {
+		loader, ok := exp.loader.(func(K) (E, time.Duration, error))
+		if !ok {
+			return nil, fmt.Errorf("the type of the loader %T does not match the cache", exp.loader)
+		}
+		res.loader = loader
+	}
+	if exp.copier != nil {
+		copier, ok := exp.copier.(func(E) E)
+		if !ok {
+			return nil, fmt.Errorf("the type of the copier %T does not match the cache", exp.copier)
+		}
+		res.copier = copier
+	}
+	if exp.compressValues {
+		compress, decompress, ok := newCompressor[E]()
+		if !ok {
+			return nil, fmt.Errorf("the value compression requires a cache of []byte, not %T", *new(E))
+		}
+		res.compress, res.decompress = compress, decompress
+	}
+	if exp.dedupe != nil {
+		dedupe, ok := exp.dedupe.(func(E, E) bool)
+		if !ok {
+			return nil, fmt.Errorf("the type of the dedupe function %T does not match the cache", exp.dedupe)
+		}
+		res.dedupe = dedupe
+	}
+	if exp.enableStats {
+		res.stats = &cacheStats{}
+	}
+	if exp.enableEvents {
+		events, ok := exp.eventChan.(chan CacheEvent[K, E])
+		if !ok {
+			events = make(chan CacheEvent[K, E], exp.eventBuffer)
+		}
+		res.events = events
 	}
 	if exp.enablePersistence {
-		res.items = make(map[string]*Item[E])
-		err := res.startPersistence(&(res.items))
+		err := res.startPersistence()
 		if err != nil {
 			return nil, err
 		}
 	}
-	c := &MapCache[E]{
-		res,
+	res.initPolicy()
+	if exp.adaptiveGc {
+		res.gcWake = make(chan struct{}, 1)
+		res.rebuildExpiries()
 	}
-	runtime.SetFinalizer(c, func(m *MapCache[E]) {
-		_ = m.StopGc()
-	})
-	return c, nil
+	if (exp.expiration != DefaultExpiration || exp.maxTTL > 0 || exp.gcEnabled || exp.adaptiveGc) && !exp.lazy {
+		// start gc
+		_ = res.StartGc()
+	}
+	if exp.ctx != nil {
+		res.closing = make(chan struct{})
+		go res.watchContext(exp.ctx, res.closing)
+	}
+	return res, nil
 }
 
 // Expired cache data Item cleanup
-func (c *mapCache[E]) gcLoop() {
+// done is closed after the ticker is stopped, so that StopGc can wait for the loop to exit
+func (c *mapCache[K, E]) gcLoop(stop <-chan bool, done chan<- struct{}) {
+	defer close(done)
 	ticker := time.NewTicker(c.gcInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			c.DeleteExpired()
-		case <-c.stopGc:
-			ticker.Stop()
+			_ = c.DeleteExpired()
+		case <-stop:
 			return
 		}
 	}
 }
 
 // StopGc stop gc
-func (c *mapCache[E]) StopGc() error {
+// It waits for the gc goroutine to exit, calling it when gc is stopped does nothing
+func (c *mapCache[K, E]) StopGc() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	if !c.isGc {
-		return errors.New("GC is closed")
+		c.mu.Unlock()
+		return nil
 	}
 	c.isGc = false
-	c.stopGc <- true
+	stop, done := c.stopGc, c.gcDone
+	// release the lock before waiting, the gc loop may be waiting for it in DeleteExpired
+	c.mu.Unlock()
+	close(stop)
+	<-done
 	return nil
 }
 
+// IsGcRunning judge whether gc is running
+func (c *mapCache[K, E]) IsGcRunning() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isGc
+}
+
 // StartGc start gc
 // After the expiration time is set, GC will be started automatically without manual GC
-func (c *mapCache[E]) StartGc() error {
+func (c *mapCache[K, E]) StartGc() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("the cache is closed")
+	}
 	if c.isGc {
+		if c.idempotentGc {
+			return nil
+		}
 		return errors.New("GC has been started")
 	}
 	c.isGc = true
-	go c.gcLoop()
+	c.stopGc = make(chan bool)
+	c.gcDone = make(chan struct{})
+	if c.adaptiveGc {
+		go c.adaptiveGcLoop(c.stopGc, c.gcDone)
+	} else {
+		go c.gcLoop(c.stopGc, c.gcDone)
+	}
 	return nil
 }
 
+// Close stop gc and persistence, and persist the data one last time if persistence is enabled
+// It can be called repeatedly, after closing, the data can still be read and written in memory,
+// but it is no longer persisted and gc can not be started again
+func (c *mapCache[K, E]) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	if c.closing != nil {
+		close(c.closing)
+	}
+	c.mu.Unlock()
+	_ = c.StopGc()
+	return c.closePersistence()
+}
+
+// close the cache when ctx is done, it returns when the cache is closed
+func (c *mapCache[K, E]) watchContext(ctx context.Context, closing <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+		_ = c.Close()
+	case <-closing:
+	}
+}
+
 // delete data by key
-func (c *mapCache[E]) del(key string) {
+func (c *mapCache[K, E]) del(key K, reason EvictionReason) {
+	value, ok := c.items[key]
+	if !ok {
+		return
+	}
+	c.recordRemove(key)
+	c.untag(key, value)
+	c.bytes -= value.size
 	delete(c.items, key)
+	c.logDelete(key)
+	c.stats.recordRemove(reason)
+	// the data moves to the cold tier instead of leaving the cache, it is evicted if it can not be written
+	if reason == ReasonCapacity && c.overflow != nil && !value.expired(c.now()) && c.overflow.put(key, value) == nil {
+		return
+	}
+	c.addEvicted(key, value.Object, reason)
+	c.emit(eventType(reason), key, value.Object)
+}
+
+// data of the cold tier leaves the cache, its file is already removed
+func (c *mapCache[K, E]) dropOverflow(key K, value *Item[E], reason EvictionReason) {
+	c.addEvicted(key, value.Object, reason)
+	c.emit(eventType(reason), key, value.Object)
 }
 
 // set cache data by key
-func (c *mapCache[E]) set(key string, value E, expiration int64) {
-	c.items[key] = &Item[E]{
+// It returns false if the data is rejected because the cache is full, see WithFullPolicy
+func (c *mapCache[K, E]) set(key K, value E, expiration int64) bool {
+	return c.store(key, c.pack(value), expiration)
+}
+
+// set cache data by key like set, value is already in the form in which the data is stored, see pack
+func (c *mapCache[K, E]) store(key K, value E, expiration int64) bool {
+	c.judgeAndInitItem()
+	size := c.sizeOf(value)
+	if c.rejects(key, size) {
+		return false
+	}
+	c.logSet(key, value, expiration)
+	c.stats.recordSet()
+	delete(c.misses, key)
+	c.notifyWaiters(key)
+	c.emit(EventSet, key, value)
+	if item, ok := c.items[key]; ok {
+		c.untag(key, item)
+		c.bytes += size - item.size
+		item.Object = value
+		item.Expiration = expiration
+		item.size = size
+		item.cost = c.costOf(value)
+		c.schedule(key, expiration)
+		c.recordAccess(key)
+		c.evictOverCapacity()
+		return true
+	}
+	item := &Item[E]{
 		Object:     value,
 		Expiration: expiration,
+		size:       size,
+		cost:       c.costOf(value),
+	}
+	c.bytes += size
+	c.items[key] = item
+	if c.overflow != nil {
+		c.overflow.remove(key)
 	}
+	c.schedule(key, expiration)
+	c.recordInsert(key)
+	return true
+}
+
+// set data like set, or do nothing if it is equal to the data that exists by the function set by WithDedupe,
+// so that the expiration time is not reset and no event is sent
+func (c *mapCache[K, E]) setIfChanged(key K, value E, expiration int64) bool {
+	if c.dedupe != nil {
+		if item, ok := c.get(key); ok && c.dedupe(c.inflate(item.Object), value) {
+			return true
+		}
+	}
+	return c.set(key, value, expiration)
 }
 
 // get data by key
-func (c *mapCache[E]) get(key string) (*Item[E], bool) {
+func (c *mapCache[K, E]) get(key K) (*Item[E], bool) {
 	value, ok := c.items[key]
-	if !ok || value.expired() {
+	if !ok || value.expired(c.now()) {
 		return nil, false
 	}
 	return value, true
 }
 
+// get data by key, and record a hit or miss
+// With lazy expiration, the expired data found is deleted, it must be called under the write lock
+func (c *mapCache[K, E]) lookup(key K) (*Item[E], bool) {
+	value, ok := c.get(key)
+	c.stats.recordGet(ok)
+	if !ok && c.lazy {
+		if item, exists := c.items[key]; exists && item.expiredFor(c.now(), c.keepExpired()) {
+			c.del(key, ReasonExpired)
+		}
+	}
+	return value, ok
+}
+
+// Peek get data without recording an access
+// It does not promote the data in the lru order, extend its sliding expiration, count as a hit or call the loader
+func (c *mapCache[K, E]) Peek(key K) (E, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.get(key)
+	if !ok {
+		var zero E
+		return zero, false
+	}
+	return c.unpack(value.Object), true
+}
+
 // generate expiration time
-func (c *mapCache[E]) generateExpiration() int64 {
+func (c *mapCache[K, E]) generateExpiration() int64 {
 	if c.expiration == DefaultExpiration {
-		return 0
+		return c.capExpiration(0)
+	}
+	expiration := c.expiration
+	if c.jitter > 0 {
+		expiration += time.Duration((rand.Float64()*2 - 1) * c.jitter * float64(expiration))
 	}
-	return time.Now().Add(c.expiration).UnixNano() / 1e3
+	return c.capExpiration(c.now() + expiration.Microseconds())
 }
 
 // generate expiration time
-func (c *mapCache[E]) generateExpirationForItem(expiration time.Duration) int64 {
-	return time.Now().Add(expiration).UnixNano() / 1e3
+func (c *mapCache[K, E]) generateExpirationForItem(expiration time.Duration) int64 {
+	return c.capExpiration(c.now() + expiration.Microseconds())
+}
+
+// cap the expiration time at the maximum ttl set by WithMaxTTL, 0 means never expire
+func (c *mapCache[K, E]) capExpiration(expiration int64) int64 {
+	if c.maxTTL <= 0 {
+		return expiration
+	}
+	limit := c.now() + c.maxTTL.Microseconds()
+	if expiration == 0 || expiration > limit {
+		return limit
+	}
+	return expiration
+}
+
+// generate expiration time by ttl
+// 0 means the default expiration time, and negative means never expire
+func (c *mapCache[K, E]) generateExpirationWithTTL(ttl time.Duration) int64 {
+	switch {
+	case ttl == 0:
+		return c.generateExpiration()
+	case ttl < 0:
+		return c.capExpiration(0)
+	}
+	return c.generateExpirationForItem(ttl)
+}
+
+// generate expiration time by an absolute time, a zero time means never expire
+func (c *mapCache[K, E]) generateExpirationAt(at time.Time) int64 {
+	if at.IsZero() {
+		return c.capExpiration(0)
+	}
+	expiration := at.UnixNano() / 1e3
+	if expiration == c.now() {
+		// data is only expired after its expiration time, so that now expires the data immediately
+		expiration--
+	}
+	return c.capExpiration(expiration)
+}
+
+// add data if the key does not exist
+// Expired data that has not been cleaned up is treated as absent and overwritten, the same as Get
+func (c *mapCache[K, E]) add(key K, value E, expiration int64) error {
+	if _, ok := c.get(key); ok {
+		return fmt.Errorf("data %v already exists", key)
+	}
+	if !c.set(key, value, expiration) {
+		return ErrCacheFull
+	}
+	return nil
+}
+
+// record an access to the data
+// With sliding expiration, the expiration time is extended by the default expiration time
+func (c *mapCache[K, E]) access(key K, item *Item[E]) {
+	c.recordAccess(key)
+	if c.trackAccess {
+		item.hits++
+	}
+	if c.sliding && item.Expiration != 0 {
+		item.Expiration = c.generateExpiration()
+	}
 }
 
 // init data
-func (c *mapCache[E]) judgeAndInitItem() {
+// It is called by set, the only place that adds data, so data set after Clear always lands in the map of Clear
+func (c *mapCache[K, E]) judgeAndInitItem() {
 	if c.items == nil {
-		c.items = make(map[string]*Item[E])
+		c.items = c.newItems()
 	}
 }
 
+// create an empty map of data with the capacity set by WithInitialCapacity
+func (c *mapCache[K, E]) newItems() map[K]*Item[E] {
+	return make(map[K]*Item[E], c.initialCapacity)
+}
+
 // IsExpired judge whether the data is expired
-func (c *mapCache[E]) IsExpired(key string) (bool, error) {
+func (c *mapCache[K, E]) IsExpired(key K) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	value, ok := c.items[key]
 	if !ok {
-		return false, fmt.Errorf("the data %s does not exist", key)
+		return false, notFound(key)
 	}
-	return value.expired(), nil
+	return value.expired(c.now()), nil
 }
 
-// DeleteExpired delete all expired data
-func (c *mapCache[E]) DeleteExpired() {
+// DeleteExpired delete all expired data, and return the number of data deleted
+func (c *mapCache[K, E]) DeleteExpired() int {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	for k, v := range c.items {
-		if v.expired() {
-			c.del(k)
+	count := 0
+	now := c.now()
+	if c.gcBatchSize > 0 {
+		count = c.deleteExpiredInBatches(now)
+	} else {
+		for k, v := range c.items {
+			if v.expiredFor(now, c.keepExpired()) {
+				c.del(k, ReasonExpired)
+				count++
+			}
+		}
+	}
+	c.deleteExpiredMisses()
+	if c.overflow != nil {
+		for k, v := range c.overflow.deleteExpired(now) {
+			c.dropOverflow(k, v, ReasonExpired)
+			count++
+		}
+	}
+	return count
+}
+
+// delete expired data, releasing and reacquiring the write lock after every gcBatchSize data scanned
+// so that other operations are not blocked for the whole scan. The map being scanned may be replaced by Clear
+// or changed while the lock is released, so the data is looked up again before it is deleted
+func (c *mapCache[K, E]) deleteExpiredInBatches(now int64) int {
+	count := 0
+	scanned := 0
+	items := c.items
+	for k := range items {
+		if item, ok := c.items[k]; ok && item.expiredFor(now, c.keepExpired()) {
+			c.del(k, ReasonExpired)
+			count++
+		}
+		scanned++
+		if scanned%c.gcBatchSize == 0 {
+			c.unlock()
+			if c.gcSleep > 0 {
+				c.sleep(c.gcSleep)
+			}
+			c.mu.Lock()
 		}
 	}
+	return count
 }
 
 // Delete delete data by key
-func (c *mapCache[E]) Delete(key string) (E, bool) {
+func (c *mapCache[K, E]) Delete(key K) (E, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+	delete(c.misses, key)
 	value, ok := c.get(key)
 	if ok {
-		c.del(key)
-		return value.Object, ok
+		c.del(key, ReasonDeleted)
+		return c.inflate(value.Object), ok
 	}
 	var zero E
 	return zero, ok
 }
 
 // Set  data by key，it will overwrite the data if the key exists
-func (c *mapCache[E]) Set(key string, value E) {
+func (c *mapCache[K, E]) Set(key K, value E) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.judgeAndInitItem()
+	defer c.unlock()
+
+	c.setIfChanged(key, value, c.generateExpiration())
+}
 
-	c.set(key, value, c.generateExpiration())
+// SetReport set data by key like Set, and report whether it replaced data that exists
+// Expired data that has not been cleaned up does not count, and it returns false if the data is rejected
+// because the cache is full
+func (c *mapCache[K, E]) SetReport(key K, value E) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	_, ok := c.get(key)
+	return c.setIfChanged(key, value, c.generateExpiration()) && ok
 }
 
 // SetDefault  data by key，it will overwrite the data if the key exists
-func (c *mapCache[E]) SetDefault(key string, value E, expiration time.Duration) {
+func (c *mapCache[K, E]) SetDefault(key K, value E, expiration time.Duration) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.judgeAndInitItem()
+	defer c.unlock()
 
-	c.set(key, value, c.generateExpirationForItem(expiration))
+	c.setIfChanged(key, value, c.generateExpirationForItem(expiration))
 }
 
 // Add data，Cannot add existing data
 // To override the addition, use the set method
-func (c *mapCache[E]) Add(key string, value E) error {
+func (c *mapCache[K, E]) Add(key K, value E) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.judgeAndInitItem()
-	if _, ok := c.items[key]; ok {
-		return fmt.Errorf("data %s already exists", key)
+	defer c.unlock()
+	return c.add(key, value, c.generateExpiration())
+}
+
+// Replace replace the data only if the key exists and the data is not expired, otherwise it returns an error
+// The expiration time is reset to the default expiration time
+func (c *mapCache[K, E]) Replace(key K, value E) error {
+	c.mu.Lock()
+	defer c.unlock()
+	if _, ok := c.get(key); !ok {
+		return notFound(key)
+	}
+	if !c.set(key, value, c.generateExpiration()) {
+		return ErrCacheFull
 	}
+	return nil
+}
 
-	c.set(key, value, c.generateExpiration())
+// ReplaceKeepTTL replace the data only if the key exists and the data is not expired, otherwise it returns an error
+// The expiration time is not changed
+func (c *mapCache[K, E]) ReplaceKeepTTL(key K, value E) error {
+	c.mu.Lock()
+	defer c.unlock()
+	item, ok := c.get(key)
+	if !ok {
+		return notFound(key)
+	}
+	if !c.set(key, value, item.Expiration) {
+		return ErrCacheFull
+	}
 	return nil
 }
 
+// CompareAndSwap replace the data with newValue only if the data exists and is equal to oldValue judged by eq
+// The expiration time is not changed, it returns whether the data is replaced,
+// which is false if newValue is rejected because the cache is full, see WithFullPolicy
+func (c *mapCache[K, E]) CompareAndSwap(key K, oldValue, newValue E, eq func(a, b E) bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.get(key)
+	if !ok || !eq(c.inflate(value.Object), oldValue) {
+		return false
+	}
+	return c.set(key, newValue, value.Expiration)
+}
+
+// CompareAndDelete delete the data only if the data exists and is equal to oldValue judged by eq
+// It returns whether the data is deleted
+func (c *mapCache[K, E]) CompareAndDelete(key K, oldValue E, eq func(a, b E) bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.get(key)
+	if !ok || !eq(c.inflate(value.Object), oldValue) {
+		return false
+	}
+	c.del(key, ReasonDeleted)
+	return true
+}
+
+// Update read, modify and write the data under one write lock, so that the update is atomic
+// fn gets the data and whether it exists, and returns the new data and whether to set it. The expiration time of
+// the data is not changed, new data gets the default expiration time. fn must not access the cache, it deadlocks
+// It returns the data after the update and whether it is set
+func (c *mapCache[K, E]) Update(key K, fn func(old E, exists bool) (E, bool)) (E, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	var old E
+	expiration := c.generateExpiration()
+	item, ok := c.get(key)
+	if ok {
+		old = c.unpack(item.Object)
+		expiration = item.Expiration
+	}
+	value, commit := fn(old, ok)
+	if !commit || !c.set(key, value, expiration) {
+		return old, false
+	}
+	return value, true
+}
+
+// SetWithTTL  data by key with ttl，it will overwrite the data if the key exists
+// A ttl greater than 0 expires the data ttl after now, a ttl of 0 means the default expiration time set by
+// SetExpirationTime, so the data never expires if it is DefaultExpiration, and a negative ttl means never expire
+func (c *mapCache[K, E]) SetWithTTL(key K, value E, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.setIfChanged(key, value, c.generateExpirationWithTTL(ttl))
+}
+
+// SetWithTTLReport set data by key with ttl like SetWithTTL, and report the expiration time stored for the data
+// The time is zero if the data never expires, it returns false if the data is rejected because the cache is full
+func (c *mapCache[K, E]) SetWithTTLReport(key K, value E, ttl time.Duration) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.setIfChanged(key, value, c.generateExpirationWithTTL(ttl)) {
+		return time.Time{}, false
+	}
+	// the data is evicted at once if it is larger than the byte limit
+	item, ok := c.items[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return item.ExpiresAt(), true
+}
+
+// AddWithTTL add data with ttl，Cannot add existing data
+// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+func (c *mapCache[K, E]) AddWithTTL(key K, value E, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.add(key, value, c.generateExpirationWithTTL(ttl))
+}
+
+// SetIfAbsent set data with ttl only if the data does not exist or expires, and return whether it is set
+// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+func (c *mapCache[K, E]) SetIfAbsent(key K, value E, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if _, ok := c.get(key); ok {
+		return false
+	}
+	return c.set(key, value, c.generateExpirationWithTTL(ttl))
+}
+
 // Get  data
 // When the data does not exist or expires, it will return nonexistence（false）
-func (c *mapCache[E]) Get(key string) (E, bool) {
+// If a loader is set by WithLoader, it loads the data instead, and returns false if the loader returns an error
+func (c *mapCache[K, E]) Get(key K) (E, bool) {
+	value, ok := c.getLocal(key)
+	if ok || c.loader == nil {
+		return value, ok
+	}
+	value, err := c.load(key)
+	return value, err == nil
+}
+
+// MustGet get data, it is the same as Get but returns an error wrapping ErrKeyNotFound
+// when the data does not exist, expires or can not be loaded
+func (c *mapCache[K, E]) MustGet(key K) (E, error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return value, notFound(key)
+	}
+	return value, nil
+}
+
+// GetOrDefault get data, or def when the data does not exist or expires
+func (c *mapCache[K, E]) GetOrDefault(key K, def E) E {
+	if value, ok := c.Get(key); ok {
+		return value
+	}
+	return def
+}
+
+// get data without calling the loader
+func (c *mapCache[K, E]) getLocal(key K) (E, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	value, ok := c.items[key]
-	if !ok || value.expired() {
+	defer c.unlock()
+	value, ok := c.lookup(key)
+	if !ok {
 		var zero E
 		return zero, false
 	}
-	return value.Object, true
+	c.access(key, value)
+	if c.refreshAhead > 0 && value.Expiration != 0 && value.Expiration-c.now() <= c.refreshAhead.Microseconds() {
+		c.refresh(key)
+	}
+	return c.unpack(value.Object), true
+}
+
+// GetOrSet get data, or set data when the data does not exist or expires
+// It returns true if the data exists, otherwise it returns the value that was set and false
+// It returns ErrCacheFull if the data does not exist and value is rejected because the cache is full, see WithFullPolicy
+func (c *mapCache[K, E]) GetOrSet(key K, value E) (E, bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if item, ok := c.lookup(key); ok {
+		c.access(key, item)
+		return c.unpack(item.Object), true, nil
+	}
+	if !c.set(key, value, c.generateExpiration()) {
+		var zero E
+		return zero, false, ErrCacheFull
+	}
+	return value, false, nil
+}
+
+// GetAndSet set data by key and return the previous data
+// It returns false if the previous data does not exist or expires, the new data gets the default expiration time
+// It returns ErrCacheFull and keeps the previous data if value is rejected because the cache is full, see WithFullPolicy
+func (c *mapCache[K, E]) GetAndSet(key K, value E) (E, bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var previous E
+	item, ok := c.lookup(key)
+	if ok {
+		previous = c.inflate(item.Object)
+	}
+	if !c.set(key, value, c.generateExpiration()) {
+		return previous, ok, ErrCacheFull
+	}
+	return previous, ok, nil
+}
+
+// Rename move the data to newKey under one lock, keeping its value and expiration time
+// It returns false if the data of oldKey does not exist or expires, the data of newKey is overwritten if it exists
+func (c *mapCache[K, E]) Rename(oldKey, newKey K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.rename(c, oldKey, newKey)
+}
+
+// move the data of oldKey to newKey of the cache to, both caches must be locked
+func (c *mapCache[K, E]) rename(to *mapCache[K, E], oldKey, newKey K) bool {
+	item, ok := c.get(oldKey)
+	if !ok {
+		return false
+	}
+	if c == to && oldKey == newKey {
+		return true
+	}
+	value, expiration := item.Object, item.Expiration
+	c.del(oldKey, ReasonDeleted)
+	return to.store(newKey, to.repack(value), expiration)
+}
+
+// GetOrCompute get data, or compute and set data when the data does not exist or expires
+// fn is only called on a miss and is called under the lock of the key, so it is computed exactly once,
+// computations for different keys run in parallel and other operations on the cache are not blocked
+// fn must not call GetOrCompute with the same key, otherwise it deadlocks
+// If fn returns an error, nothing is set
+func (c *mapCache[K, E]) GetOrCompute(key K, fn func() (E, error)) (E, error) {
+	c.computeLocks.lock(key)
+	defer c.computeLocks.unlock(key)
+	if value, ok := c.getLocal(key); ok {
+		return value, nil
+	}
+	value, err := fn()
+	if err != nil {
+		var zero E
+		return zero, err
+	}
+	c.Set(key, value)
+	return value, nil
+}
+
+// GetOrComputeCtx get data, or compute and set data when the data does not exist or expires
+// Concurrent callers for the same key share a single computation, which runs without holding the lock,
+// so other keys are not blocked. fn is called with the ctx of the caller that starts the computation,
+// and each caller stops waiting and returns ctx.Err() when its own ctx is done
+// If fn returns an error, nothing is set
+func (c *mapCache[K, E]) GetOrComputeCtx(ctx context.Context, key K, fn func(context.Context) (E, error)) (E, error) {
+	if value, ok := c.getLocal(key); ok {
+		return value, nil
+	}
+	call := c.computes.do(key, func() (E, error) {
+		// the data may have been set by a computation that has just finished
+		if value, ok := c.Peek(key); ok {
+			return value, nil
+		}
+		value, err := fn(ctx)
+		if err != nil {
+			return value, err
+		}
+		c.Set(key, value)
+		return value, nil
+	})
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		var zero E
+		return zero, ctx.Err()
+	}
+}
+
+// GetLoad get data, or load and set data with the loader set by WithLoader when the data does not exist or expires
+// It returns the error of the loader, or an error if no loader is set and the data does not exist
+func (c *mapCache[K, E]) GetLoad(key K) (E, error) {
+	if value, ok := c.getLocal(key); ok {
+		return value, nil
+	}
+	if c.loader == nil {
+		var zero E
+		return zero, notFound(key)
+	}
+	return c.load(key)
+}
+
+// load the data with the loader, concurrent loads for the same key share a single call
+func (c *mapCache[K, E]) load(key K) (E, error) {
+	call := c.startLoad(key)
+	<-call.done
+	if call.err != nil {
+		var zero E
+		return zero, call.err
+	}
+	return call.value, nil
+}
+
+// start loading the data with the loader without holding the lock, or join the load in flight for the key
+func (c *mapCache[K, E]) startLoad(key K) *call[E] {
+	return c.flight.do(key, func() (E, error) {
+		// the data may have been set by a load that has just finished
+		if value, ok := c.Peek(key); ok {
+			return value, nil
+		}
+		if value, ok := c.staleBackoff(key); ok {
+			return value, nil
+		}
+		value, ttl, err := c.loader(key)
+		if err != nil {
+			if stale, ok := c.staleOnError(key); ok {
+				return stale, nil
+			}
+			return value, err
+		}
+		c.loadSucceeded(key)
+		c.SetWithTTL(key, value, ttl)
+		return value, nil
+	})
+}
+
+// reload the data with the loader in the background, or do nothing if a reload of the key is in flight
+func (c *mapCache[K, E]) refresh(key K) {
+	c.refreshes.do(key, func() (E, error) {
+		value, ttl, err := c.loader(key)
+		if err != nil {
+			return value, err
+		}
+		// the expiration time is reset even if the data is unchanged, so WithDedupe does not apply
+		c.mu.Lock()
+		defer c.unlock()
+		c.set(key, value, c.generateExpirationWithTTL(ttl))
+		return value, nil
+	})
 }
 
 // GetAndDelete get data and delete by key
-func (c *mapCache[E]) GetAndDelete(key string) (E, bool) {
+func (c *mapCache[K, E]) GetAndDelete(key K) (E, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	value, ok := c.items[key]
-	if !ok || value.expired() {
+	defer c.unlock()
+	value, ok := c.lookup(key)
+	if !ok {
 		var zero E
 		return zero, false
 	}
 	// delete
-	c.del(key)
-	return value.Object, true
+	c.del(key, ReasonDeleted)
+	return c.inflate(value.Object), true
 }
 
 // GetAndExpired  get data and expire by key
 // It will be deleted at the next clearing. If the clearing capability is not enabled, it will never be deleted
-func (c *mapCache[E]) GetAndExpired(key string) (E, bool) {
+func (c *mapCache[K, E]) GetAndExpired(key K) (E, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	value, ok := c.items[key]
-	if !ok || value.expired() {
+	defer c.unlock()
+	value, ok := c.lookup(key)
+	if !ok {
 		var zero E
 		return zero, false
 	}
-	// SetDefault now as expiration time
-	c.set(key, value.Object, time.Now().UnixNano()/1e3)
-	return value.Object, true
+	// SetDefault now as expiration time, the data returned is no longer held by the cache since set stores a copy of it
+	object := value.Object
+	c.store(key, c.repack(object), c.now())
+	return c.inflate(object), true
 }
 
-func (c *mapCache[E]) GetWithExpiration(key string) (E, time.Time, bool) {
+// GetStale get data, or data that has expired within the grace set by WithStaleWhileRevalidate
+// stale is true if the data is expired, so that the caller can refresh it
+func (c *mapCache[K, E]) GetStale(key K) (value E, stale bool, ok bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	value, ok := c.items[key]
-	if !ok || value.expired() {
+	defer c.unlock()
+	if item, ok := c.lookup(key); ok {
+		c.access(key, item)
+		return c.unpack(item.Object), false, true
+	}
+	if item, ok := c.items[key]; ok && !item.expiredFor(c.now(), c.staleGrace) {
+		return c.unpack(item.Object), true, true
+	}
+	return value, false, false
+}
+
+// GetWithExpiration get data and its expiration time in one call
+// The expiration time is the zero time.Time if the data never expires
+func (c *mapCache[K, E]) GetWithExpiration(key K) (E, time.Time, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.lookup(key)
+	if !ok {
 		var zero E
 		return zero, time.Time{}, false
 	}
-	return value.Object, time.UnixMicro(value.Expiration), true
+	if value.Expiration == 0 {
+		return c.unpack(value.Object), time.Time{}, true
+	}
+	return c.unpack(value.Object), time.UnixMicro(value.Expiration), true
+}
+
+// TTL get the remaining time before the data expires
+// It returns false if the data does not exist or expires, and DefaultExpiration if the data never expires
+func (c *mapCache[K, E]) TTL(key K) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.get(key)
+	if !ok {
+		return 0, false
+	}
+	if value.Expiration == 0 {
+		return DefaultExpiration, true
+	}
+	// Expiration is stored in microseconds
+	return time.Duration(value.Expiration-c.now()) * time.Microsecond, true
+}
+
+// Touch reset the expiration time of the data without changing the data
+// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+// It returns false if the data does not exist or expires, expired data can not be touched even if GC has not removed it yet
+func (c *mapCache[K, E]) Touch(key K, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.get(key)
+	if !ok {
+		return false
+	}
+	value.Expiration = c.generateExpirationWithTTL(ttl)
+	c.schedule(key, value.Expiration)
+	c.logSet(key, value.Object, value.Expiration)
+	return true
+}
+
+// GetTouch get data and reset its expiration time to extend from now under one write lock,
+// so that some reads slide the expiration time without WithSlidingExpiration
+// An extend of 0 means the default expiration time, and a negative extend means never expire
+// It returns false if the data does not exist or expires, the loader is not called
+func (c *mapCache[K, E]) GetTouch(key K, extend time.Duration) (E, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.lookup(key)
+	if !ok {
+		var zero E
+		return zero, false
+	}
+	c.access(key, value)
+	value.Expiration = c.generateExpirationWithTTL(extend)
+	c.schedule(key, value.Expiration)
+	c.logSet(key, value.Object, value.Expiration)
+	return c.unpack(value.Object), true
+}
+
+// ExpireAt set the absolute expiration time of the data without changing the data
+// A zero at means never expire, and a past at expires the data immediately
+// It returns false if the data does not exist or expires
+func (c *mapCache[K, E]) ExpireAt(key K, at time.Time) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.get(key)
+	if !ok {
+		return false
+	}
+	value.Expiration = c.generateExpirationAt(at)
+	c.schedule(key, value.Expiration)
+	c.logSet(key, value.Object, value.Expiration)
+	return true
+}
+
+// SetExpireAt set data by key with an absolute expiration time, it will overwrite the data if the key exists
+// A zero at means never expire, and a past at expires the data immediately
+func (c *mapCache[K, E]) SetExpireAt(key K, value E, at time.Time) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.setIfChanged(key, value, c.generateExpirationAt(at))
+}
+
+// SetMany set all data in items with the default expiration time under one lock
+// it will overwrite the data if the key exists
+func (c *mapCache[K, E]) SetMany(items map[K]E) {
+	c.mu.Lock()
+	defer c.unlock()
+	for k, v := range items {
+		c.setIfChanged(k, v, c.generateExpiration())
+	}
+}
+
+// SetManyWithTTL set all data in entries with their own ttl under one lock
+// it will overwrite the data if the key exists
+func (c *mapCache[K, E]) SetManyWithTTL(entries map[K]ItemSpec[E]) {
+	c.mu.Lock()
+	defer c.unlock()
+	for k, v := range entries {
+		c.setIfChanged(k, v.Value, c.generateExpirationWithTTL(v.TTL))
+	}
+}
+
+// GetMany get data of keys under one lock
+// Data that does not exist or expires is omitted from the result
+func (c *mapCache[K, E]) GetMany(keys []K) map[K]E {
+	c.mu.Lock()
+	defer c.unlock()
+	res := make(map[K]E, len(keys))
+	for _, k := range keys {
+		if value, ok := c.lookup(k); ok {
+			c.access(k, value)
+			res[k] = c.unpack(value.Object)
+		}
+	}
+	return res
+}
+
+// GetManyCtx get data of keys, and load the data that does not exist or expires with the loader set by WithLoader
+// The loads run in parallel without holding the lock, data that can not be loaded is omitted from the result
+// When ctx is done, it stops waiting and returns the data resolved so far with ctx.Err()
+func (c *mapCache[K, E]) GetManyCtx(ctx context.Context, keys []K) (map[K]E, error) {
+	if err := ctx.Err(); err != nil {
+		return make(map[K]E), err
+	}
+	res := c.GetMany(keys)
+	if c.loader == nil || len(res) == len(keys) {
+		return res, nil
+	}
+	calls := make(map[K]*call[E])
+	for _, k := range keys {
+		if _, ok := res[k]; !ok {
+			calls[k] = c.startLoad(k)
+		}
+	}
+	for k, call := range calls {
+		select {
+		case <-call.done:
+			if call.err == nil {
+				res[k] = call.value
+			}
+		case <-ctx.Done():
+			// keep the loads that have finished
+			for k, call := range calls {
+				select {
+				case <-call.done:
+					if call.err == nil {
+						res[k] = call.value
+					}
+				default:
+				}
+			}
+			return res, ctx.Err()
+		}
+	}
+	return res, nil
+}
+
+// DeleteWhere delete all data for which pred returns true under one lock, and return the number of data deleted
+// Expired data that has not been cleaned up is skipped, pred is called under the write lock,
+// it must not call back into the cache, otherwise it deadlocks
+func (c *mapCache[K, E]) DeleteWhere(pred func(key K, value E) bool) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := 0
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) && pred(k, c.inflate(v.Object)) {
+			c.del(k, ReasonDeleted)
+			count++
+		}
+	}
+	return count
+}
+
+// GetAndDeleteMany get data of keys and delete them under one lock
+// Data that does not exist or expires is omitted from the result
+func (c *mapCache[K, E]) GetAndDeleteMany(keys []K) map[K]E {
+	c.mu.Lock()
+	defer c.unlock()
+	res := make(map[K]E, len(keys))
+	for _, k := range keys {
+		if value, ok := c.lookup(k); ok {
+			res[k] = c.inflate(value.Object)
+			c.del(k, ReasonDeleted)
+		}
+	}
+	return res
+}
+
+// DeleteMany delete data of keys under one lock
+func (c *mapCache[K, E]) DeleteMany(keys []K) {
+	c.mu.Lock()
+	defer c.unlock()
+	for _, k := range keys {
+		delete(c.misses, k)
+		c.del(k, ReasonDeleted)
+	}
+}
+
+// Range call fn for each data, it stops if fn returns false
+// Expired data that has not been cleaned up is skipped
+// fn is called under the read lock, it must not call back into the cache, otherwise it may deadlock
+func (c *mapCache[K, E]) Range(fn func(key K, value E) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	for k, v := range c.items {
+		if v.expired(now) {
+			continue
+		}
+		if !fn(k, c.unpack(v.Object)) {
+			return
+		}
+	}
+}
+
+// Items get a copy of all data
+// Expired data that has not been cleaned up is skipped, changing the result does not affect the cache
+func (c *mapCache[K, E]) Items() map[K]E {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make(map[K]E, len(c.items))
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) {
+			res[k] = c.unpack(v.Object)
+		}
+	}
+	return res
 }
 
 // Clear remove all data
-func (c *mapCache[E]) Clear() {
-	c.items = make(map[string]*Item[E])
+// The data is swapped for an empty map under the lock, so the lock is held for O(1) time,
+// the statistics, the eviction callback and the events of the removed data are handled after the lock is released
+func (c *mapCache[K, E]) Clear() {
+	c.mu.Lock()
+	items := c.items
+	c.items = c.newItems()
+	c.expiries = nil
+	c.tags = nil
+	c.logClear()
+	c.misses = nil
+	c.bytes = 0
+	if c.policy != nil {
+		c.policy.Reset()
+	}
+	c.unlock()
+	if c.stats == nil && c.onEvicted == nil && c.events == nil {
+		return
+	}
+	for k, v := range items {
+		c.stats.recordRemove(ReasonCleared)
+		if c.onEvicted != nil {
+			c.onEvicted(k, c.inflate(v.Object), ReasonCleared)
+		}
+		c.emit(EventDelete, k, v.Object)
+	}
 }
 
 // Keys get all keys
-func (c *mapCache[E]) Keys() []string {
-	res := make([]string, 0)
-	for k := range c.items {
-		res = append(res, k)
+// Expired data that has not been cleaned up is skipped
+func (c *mapCache[K, E]) Keys() []K {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make([]K, 0)
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) {
+			res = append(res, k)
+		}
 	}
 	return res
 }
+
+// Len get the number of data
+// Expired data that has not been cleaned up is not counted, it scans all data, so it is O(n)
+func (c *mapCache[K, E]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	count := 0
+	now := c.now()
+	for _, v := range c.items {
+		if !v.expired(now) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,774 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ShardedMapCache a cache that hashes the key to one of several shards,
+// each shard is a mapCache with its own lock, which reduces lock contention under high concurrency
+type ShardedMapCache[E any] struct {
+	shards []*mapCache[string, E]
+	hasher func(key string) uint64 // Hash of the key that selects the shard
+	config CacheConfig             // Options of the shards with the totals of all shards
+}
+
+// NewShardedMapCache create a cache with shardCount shards
+// The options apply to each shard, except that the maximum number and size of data and the initial capacity
+// are split evenly across shards,
+// and each shard is persisted to its own file with the shard index appended to the persistence name
+func NewShardedMapCache[E any](shardCount int, opts ...CreateOptionFunc) (MapInterface[E], error) {
+	if shardCount <= 0 {
+		return nil, errors.New("the number of shards must be greater than 0")
+	}
+	exp := newOption()
+	for _, opt := range opts {
+		opt(&exp)
+	}
+	if err := exp.validate(); err != nil {
+		return nil, err
+	}
+	if _, ok := exp.evictionPolicy.(policyTemplate); !ok && shardCount > 1 {
+		return nil, errors.New("a custom eviction policy can not be shared by the shards")
+	}
+	maxEntries, maxBytes := exp.maxEntries, exp.maxBytes
+	if exp.maxEntries > 0 {
+		exp.maxEntries = (exp.maxEntries + shardCount - 1) / shardCount
+	}
+	if exp.maxBytes > 0 {
+		exp.maxBytes = (exp.maxBytes + int64(shardCount) - 1) / int64(shardCount)
+	}
+	if exp.initialCapacity > 0 {
+		exp.initialCapacity = (exp.initialCapacity + shardCount - 1) / shardCount
+	}
+	if exp.enableEvents && exp.eventBuffer > 0 {
+		// all shards send to the same channel
+		exp.eventChan = make(chan CacheEvent[string, E], exp.eventBuffer)
+	}
+	if exp.enablePersistence {
+		// all shards send to the same channel
+		exp.persistErrors = make(chan error, persistErrorBuffer)
+	}
+	name := exp.persistenceName
+	walPath := exp.walPath
+	c := &ShardedMapCache[E]{
+		shards: make([]*mapCache[string, E], 0, shardCount),
+		hasher: exp.shardHasher,
+	}
+	if c.hasher == nil {
+		c.hasher = fnv1a
+	}
+	for i := 0; i < shardCount; i++ {
+		exp.persistenceName = fmt.Sprintf("%s_%d", name, i)
+		if walPath != "" {
+			exp.walPath = fmt.Sprintf("%s_%d", walPath, i)
+		}
+		shard, err := createMapCache[string, E](exp)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		c.shards = append(c.shards, shard)
+	}
+	c.config = c.shards[0].Config()
+	c.config.MaxEntries, c.config.MaxBytes = maxEntries, maxBytes
+	c.config.PersistenceName, c.config.WALPath = name, walPath
+	runtime.SetFinalizer(c, func(m *ShardedMapCache[E]) {
+		_ = m.Close()
+	})
+	return c, nil
+}
+
+// get the shard of the key, using the hash set by WithShardHasher
+func (c *ShardedMapCache[E]) shard(key string) *mapCache[string, E] {
+	return c.shards[c.hasher(key)%uint64(len(c.shards))]
+}
+
+// the fnv-1a hash of the key, the default hash that selects the shard
+func fnv1a(key string) uint64 {
+	var hash uint64 = 14695981039346656037
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// group keys by shard
+func (c *ShardedMapCache[E]) group(keys []string) map[*mapCache[string, E]][]string {
+	res := make(map[*mapCache[string, E]][]string)
+	for _, k := range keys {
+		shard := c.shard(k)
+		res[shard] = append(res[shard], k)
+	}
+	return res
+}
+
+// IsExpired judge whether the data is expired
+func (c *ShardedMapCache[E]) IsExpired(key string) (bool, error) {
+	return c.shard(key).IsExpired(key)
+}
+
+// ExpiryInfo get the expiration state of the data
+func (c *ShardedMapCache[E]) ExpiryInfo(key string) (ExpiryStatus, error) {
+	return c.shard(key).ExpiryInfo(key)
+}
+
+// DeleteExpired delete all expired data of all shards, and return the number of data deleted
+func (c *ShardedMapCache[E]) DeleteExpired() int {
+	count := 0
+	for _, shard := range c.shards {
+		count += shard.DeleteExpired()
+	}
+	return count
+}
+
+// StartGc start gc of all shards
+func (c *ShardedMapCache[E]) StartGc() error {
+	var err error
+	for _, shard := range c.shards {
+		if e := shard.StartGc(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// StopGc stop gc of all shards
+func (c *ShardedMapCache[E]) StopGc() error {
+	for _, shard := range c.shards {
+		_ = shard.StopGc()
+	}
+	return nil
+}
+
+// IsGcRunning judge whether gc of all shards is running
+func (c *ShardedMapCache[E]) IsGcRunning() bool {
+	for _, shard := range c.shards {
+		if !shard.IsGcRunning() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close close all shards
+func (c *ShardedMapCache[E]) Close() error {
+	var err error
+	for _, shard := range c.shards {
+		if e := shard.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Get  data
+// When the data does not exist or expires, it will return nonexistence（false）
+func (c *ShardedMapCache[E]) Get(key string) (E, bool) {
+	return c.shard(key).Get(key)
+}
+
+// MustGet get data, it returns an error wrapping ErrKeyNotFound when the data does not exist or expires
+func (c *ShardedMapCache[E]) MustGet(key string) (E, error) {
+	return c.shard(key).MustGet(key)
+}
+
+// GetOrDefault get data, or def when the data does not exist or expires
+func (c *ShardedMapCache[E]) GetOrDefault(key string, def E) E {
+	return c.shard(key).GetOrDefault(key, def)
+}
+
+// GetLoad get data, or load and set data with the loader set by WithLoader when the data does not exist or expires
+func (c *ShardedMapCache[E]) GetLoad(key string) (E, error) {
+	return c.shard(key).GetLoad(key)
+}
+
+// Peek get data without recording an access
+func (c *ShardedMapCache[E]) Peek(key string) (E, bool) {
+	return c.shard(key).Peek(key)
+}
+
+// GetAndDelete get data and delete by key
+func (c *ShardedMapCache[E]) GetAndDelete(key string) (E, bool) {
+	return c.shard(key).GetAndDelete(key)
+}
+
+// GetAndExpired  get data and expire by key
+func (c *ShardedMapCache[E]) GetAndExpired(key string) (E, bool) {
+	return c.shard(key).GetAndExpired(key)
+}
+
+// GetStale get data, or data that has expired within the grace set by WithStaleWhileRevalidate
+func (c *ShardedMapCache[E]) GetStale(key string) (value E, stale bool, ok bool) {
+	return c.shard(key).GetStale(key)
+}
+
+// GetWithExpiration get data and its expiration time in one call
+func (c *ShardedMapCache[E]) GetWithExpiration(key string) (E, time.Time, bool) {
+	return c.shard(key).GetWithExpiration(key)
+}
+
+// TTL get the remaining time before the data expires
+func (c *ShardedMapCache[E]) TTL(key string) (time.Duration, bool) {
+	return c.shard(key).TTL(key)
+}
+
+// Touch reset the expiration time of the data without changing the data
+func (c *ShardedMapCache[E]) Touch(key string, ttl time.Duration) bool {
+	return c.shard(key).Touch(key, ttl)
+}
+
+// GetTouch get data and reset its expiration time to extend from now
+func (c *ShardedMapCache[E]) GetTouch(key string, extend time.Duration) (E, bool) {
+	return c.shard(key).GetTouch(key, extend)
+}
+
+// WaitGet get data, or block until the data is set when it does not exist or expires
+func (c *ShardedMapCache[E]) WaitGet(ctx context.Context, key string) (E, error) {
+	return c.shard(key).WaitGet(ctx, key)
+}
+
+// ExpireAt set the absolute expiration time of the data without changing the data
+func (c *ShardedMapCache[E]) ExpireAt(key string, at time.Time) bool {
+	return c.shard(key).ExpireAt(key, at)
+}
+
+// Delete delete data by key
+func (c *ShardedMapCache[E]) Delete(key string) (E, bool) {
+	return c.shard(key).Delete(key)
+}
+
+// Stats get the sum of the statistics of all shards
+func (c *ShardedMapCache[E]) Stats() CacheStats {
+	var res CacheStats
+	for _, shard := range c.shards {
+		stats := shard.Stats()
+		res.Hits += stats.Hits
+		res.Misses += stats.Misses
+		res.Sets += stats.Sets
+		res.Evictions += stats.Evictions
+		res.Deletes += stats.Deletes
+		res.Entries += stats.Entries
+		res.Bytes += stats.Bytes
+	}
+	return res
+}
+
+// ApproxBytes get the approximate total size of the data of all shards, -1 if the data can not be sized
+func (c *ShardedMapCache[E]) ApproxBytes() int64 {
+	var res int64
+	for _, shard := range c.shards {
+		size := shard.ApproxBytes()
+		if size < 0 {
+			return -1
+		}
+		res += size
+	}
+	return res
+}
+
+// Events get the channel of changes of the data of all shards
+func (c *ShardedMapCache[E]) Events() <-chan CacheEvent[string, E] {
+	return c.shards[0].Events()
+}
+
+// DroppedEvents get the number of events dropped by all shards
+func (c *ShardedMapCache[E]) DroppedEvents() int64 {
+	var res int64
+	for _, shard := range c.shards {
+		res += shard.DroppedEvents()
+	}
+	return res
+}
+
+// PersistErrors get the channel of the errors of the periodic backup of all shards
+func (c *ShardedMapCache[E]) PersistErrors() <-chan error {
+	return c.shards[0].PersistErrors()
+}
+
+// TopKeys get the n most accessed keys of all shards ordered from the most accessed
+func (c *ShardedMapCache[E]) TopKeys(n int) []KeyCount[string] {
+	return c.rankKeys(n, true)
+}
+
+// BottomKeys get the n least accessed keys of all shards ordered from the least accessed
+func (c *ShardedMapCache[E]) BottomKeys(n int) []KeyCount[string] {
+	return c.rankKeys(n, false)
+}
+
+// OrderedByExpiry get the keys of all shards ordered by expiration time from the soonest,
+// the data that never expires comes last
+func (c *ShardedMapCache[E]) OrderedByExpiry() []KeyExpiry[string] {
+	var res []KeyExpiry[string]
+	for _, shard := range c.shards {
+		res = append(res, shard.OrderedByExpiry()...)
+	}
+	sortByExpiry(res)
+	return res
+}
+
+// merge the first n keys of each shard and keep the first n of them
+func (c *ShardedMapCache[E]) rankKeys(n int, most bool) []KeyCount[string] {
+	var res []KeyCount[string]
+	for _, shard := range c.shards {
+		counts := shard.rankKeys(n, most)
+		if counts == nil {
+			return nil
+		}
+		res = append(res, counts...)
+	}
+	return rankCounts(res, n, most)
+}
+
+// Set  data by key，it will overwrite the data if the key exists
+func (c *ShardedMapCache[E]) Set(key string, value E) {
+	c.shard(key).Set(key, value)
+}
+
+// SetReport set data by key like Set, and report whether it replaced data that exists
+func (c *ShardedMapCache[E]) SetReport(key string, value E) bool {
+	return c.shard(key).SetReport(key, value)
+}
+
+// SetDefault  data by key，it will overwrite the data if the key exists
+func (c *ShardedMapCache[E]) SetDefault(key string, value E, expiration time.Duration) {
+	c.shard(key).SetDefault(key, value, expiration)
+}
+
+// Add data，Cannot add existing data
+func (c *ShardedMapCache[E]) Add(key string, value E) error {
+	return c.shard(key).Add(key, value)
+}
+
+// Replace replace the data only if the key exists and the data is not expired, otherwise it returns an error
+func (c *ShardedMapCache[E]) Replace(key string, value E) error {
+	return c.shard(key).Replace(key, value)
+}
+
+// ReplaceKeepTTL replace the data only if the key exists and the data is not expired, the expiration time is not changed
+func (c *ShardedMapCache[E]) ReplaceKeepTTL(key string, value E) error {
+	return c.shard(key).ReplaceKeepTTL(key, value)
+}
+
+// CompareAndSwap replace the data with newValue only if the data exists and is equal to oldValue judged by eq
+func (c *ShardedMapCache[E]) CompareAndSwap(key string, oldValue, newValue E, eq func(a, b E) bool) bool {
+	return c.shard(key).CompareAndSwap(key, oldValue, newValue, eq)
+}
+
+// CompareAndDelete delete the data only if the data exists and is equal to oldValue judged by eq
+func (c *ShardedMapCache[E]) CompareAndDelete(key string, oldValue E, eq func(a, b E) bool) bool {
+	return c.shard(key).CompareAndDelete(key, oldValue, eq)
+}
+
+// Update read, modify and write the data under the lock of its shard
+func (c *ShardedMapCache[E]) Update(key string, fn func(old E, exists bool) (E, bool)) (E, bool) {
+	return c.shard(key).Update(key, fn)
+}
+
+// SetWithTTL  data by key with ttl，it will overwrite the data if the key exists
+func (c *ShardedMapCache[E]) SetWithTTL(key string, value E, ttl time.Duration) {
+	c.shard(key).SetWithTTL(key, value, ttl)
+}
+
+// SetWithTTLReport set data by key with ttl like SetWithTTL, and report the expiration time stored for the data
+func (c *ShardedMapCache[E]) SetWithTTLReport(key string, value E, ttl time.Duration) (time.Time, bool) {
+	return c.shard(key).SetWithTTLReport(key, value, ttl)
+}
+
+// SetExpireAt set data by key with an absolute expiration time, it will overwrite the data if the key exists
+func (c *ShardedMapCache[E]) SetExpireAt(key string, value E, at time.Time) {
+	c.shard(key).SetExpireAt(key, value, at)
+}
+
+// AddWithTTL add data with ttl，Cannot add existing data
+func (c *ShardedMapCache[E]) AddWithTTL(key string, value E, ttl time.Duration) error {
+	return c.shard(key).AddWithTTL(key, value, ttl)
+}
+
+// SetIfAbsent set data with ttl only if the data does not exist or expires, and return whether it is set
+func (c *ShardedMapCache[E]) SetIfAbsent(key string, value E, ttl time.Duration) bool {
+	return c.shard(key).SetIfAbsent(key, value, ttl)
+}
+
+// GetOrSet get data, or set data when the data does not exist or expires
+func (c *ShardedMapCache[E]) GetOrSet(key string, value E) (E, bool, error) {
+	return c.shard(key).GetOrSet(key, value)
+}
+
+// GetAndSet set data by key and return the previous data
+func (c *ShardedMapCache[E]) GetAndSet(key string, value E) (E, bool, error) {
+	return c.shard(key).GetAndSet(key, value)
+}
+
+// Rename move the data to newKey, keeping its value and expiration time
+// If the keys are in different shards, both shards are locked in order, so the data is moved atomically,
+// and the eviction callbacks are called after both locks are released
+func (c *ShardedMapCache[E]) Rename(oldKey, newKey string) bool {
+	from, to := c.hasher(oldKey)%uint64(len(c.shards)), c.hasher(newKey)%uint64(len(c.shards))
+	if from == to {
+		return c.shards[from].Rename(oldKey, newKey)
+	}
+	first, second := c.shards[from], c.shards[to]
+	if from > to {
+		first, second = second, first
+	}
+	first.mu.Lock()
+	second.mu.Lock()
+	defer unlockAll(second, first)
+	return c.shards[from].rename(c.shards[to], oldKey, newKey)
+}
+
+// SetMiss cache the fact that the key does not exist
+func (c *ShardedMapCache[E]) SetMiss(key string, ttl time.Duration) {
+	c.shard(key).SetMiss(key, ttl)
+}
+
+// GetWithStatus get data and the state of the key
+func (c *ShardedMapCache[E]) GetWithStatus(key string) (E, Status) {
+	return c.shard(key).GetWithStatus(key)
+}
+
+// GetOrCompute get data, or compute and set data when the data does not exist or expires
+// fn is called under the lock of the key
+func (c *ShardedMapCache[E]) GetOrCompute(key string, fn func() (E, error)) (E, error) {
+	return c.shard(key).GetOrCompute(key, fn)
+}
+
+// GetOrComputeCtx get data, or compute and set data when the data does not exist or expires
+// Concurrent callers for the same key share a single computation
+func (c *ShardedMapCache[E]) GetOrComputeCtx(ctx context.Context, key string, fn func(context.Context) (E, error)) (E, error) {
+	return c.shard(key).GetOrComputeCtx(ctx, key, fn)
+}
+
+// SetMany set all data in items, each shard is locked once
+func (c *ShardedMapCache[E]) SetMany(items map[string]E) {
+	groups := make(map[*mapCache[string, E]]map[string]E)
+	for k, v := range items {
+		shard := c.shard(k)
+		if groups[shard] == nil {
+			groups[shard] = make(map[string]E)
+		}
+		groups[shard][k] = v
+	}
+	for shard, group := range groups {
+		shard.SetMany(group)
+	}
+}
+
+// SetManyWithTTL set all data in entries with their own ttl, each shard is locked once
+func (c *ShardedMapCache[E]) SetManyWithTTL(entries map[string]ItemSpec[E]) {
+	groups := make(map[*mapCache[string, E]]map[string]ItemSpec[E])
+	for k, v := range entries {
+		shard := c.shard(k)
+		if groups[shard] == nil {
+			groups[shard] = make(map[string]ItemSpec[E])
+		}
+		groups[shard][k] = v
+	}
+	for shard, group := range groups {
+		shard.SetManyWithTTL(group)
+	}
+}
+
+// GetMany get data of keys, each shard is locked once
+func (c *ShardedMapCache[E]) GetMany(keys []string) map[string]E {
+	res := make(map[string]E, len(keys))
+	for shard, group := range c.group(keys) {
+		for k, v := range shard.GetMany(group) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// GetManyCtx get data of keys, and load the data that does not exist or expires with the loader set by WithLoader
+// The shards are read and loaded in parallel, each in its own goroutine
+func (c *ShardedMapCache[E]) GetManyCtx(ctx context.Context, keys []string) (map[string]E, error) {
+	res := make(map[string]E, len(keys))
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		err error
+	)
+	for shard, group := range c.group(keys) {
+		wg.Add(1)
+		go func(shard *mapCache[string, E], group []string) {
+			defer wg.Done()
+			// each shard stops waiting for its loads when ctx is done
+			values, shardErr := shard.GetManyCtx(ctx, group)
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range values {
+				res[k] = v
+			}
+			if shardErr != nil && err == nil {
+				err = shardErr
+			}
+		}(shard, group)
+	}
+	wg.Wait()
+	return res, err
+}
+
+// SetWithTags set data by key and attach tags to it
+func (c *ShardedMapCache[E]) SetWithTags(key string, value E, tags ...string) {
+	c.shard(key).SetWithTags(key, value, tags...)
+}
+
+// InvalidateTag delete all data carrying tag of all shards, and return the number of data deleted
+func (c *ShardedMapCache[E]) InvalidateTag(tag string) int {
+	count := 0
+	for _, shard := range c.shards {
+		count += shard.InvalidateTag(tag)
+	}
+	return count
+}
+
+// DeleteWhere delete all data for which pred returns true, and return the number of data deleted
+// Each shard is locked in turn, pred is called under the write lock of one shard, it must not call back into the cache
+func (c *ShardedMapCache[E]) DeleteWhere(pred func(key string, value E) bool) int {
+	count := 0
+	for _, shard := range c.shards {
+		count += shard.DeleteWhere(pred)
+	}
+	return count
+}
+
+// GetAndDeleteMany get data of keys and delete them, each shard is locked once
+// The keys of one shard are removed atomically, but not the keys across shards
+func (c *ShardedMapCache[E]) GetAndDeleteMany(keys []string) map[string]E {
+	res := make(map[string]E, len(keys))
+	for shard, group := range c.group(keys) {
+		for k, v := range shard.GetAndDeleteMany(group) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// DeleteMany delete data of keys, each shard is locked once
+func (c *ShardedMapCache[E]) DeleteMany(keys []string) {
+	for shard, group := range c.group(keys) {
+		shard.DeleteMany(group)
+	}
+}
+
+// Range call fn for each data, it stops if fn returns false
+// fn is called under the read lock of one shard, it must not call back into the cache
+func (c *ShardedMapCache[E]) Range(fn func(key string, value E) bool) {
+	next := true
+	for _, shard := range c.shards {
+		shard.Range(func(key string, value E) bool {
+			next = fn(key, value)
+			return next
+		})
+		if !next {
+			return
+		}
+	}
+}
+
+// Items get a copy of all data
+func (c *ShardedMapCache[E]) Items() map[string]E {
+	res := make(map[string]E)
+	for _, shard := range c.shards {
+		for k, v := range shard.Items() {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// Clear remove all data
+func (c *ShardedMapCache[E]) Clear() {
+	for _, shard := range c.shards {
+		shard.Clear()
+	}
+}
+
+// Keys get all keys
+func (c *ShardedMapCache[E]) Keys() []string {
+	res := make([]string, 0)
+	for _, shard := range c.shards {
+		res = append(res, shard.Keys()...)
+	}
+	return res
+}
+
+// Len get the number of data
+func (c *ShardedMapCache[E]) Len() int {
+	count := 0
+	for _, shard := range c.shards {
+		count += shard.Len()
+	}
+	return count
+}
+
+// Flush write the data of all shards to their persistence files immediately
+func (c *ShardedMapCache[E]) Flush() error {
+	var err error
+	for _, shard := range c.shards {
+		if e := shard.Flush(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// CompactAndFlush delete the expired data of all shards and write the rest to their persistence files,
+// each shard is compacted and written under its own write lock
+func (c *ShardedMapCache[E]) CompactAndFlush() error {
+	var err error
+	for _, shard := range c.shards {
+		if e := shard.CompactAndFlush(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Save write a snapshot of the data of all shards to w with the persistence codec
+func (c *ShardedMapCache[E]) Save(w io.Writer) error {
+	data, err := c.shards[0].persistenceCodec.Marshal(c.snapshot())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Load read a snapshot of the data from r with the persistence codec, and set the data to their shards
+func (c *ShardedMapCache[E]) Load(r io.Reader) error {
+	items, err := decodeSnapshot[string, E](r, c.shards[0].persistenceCodec)
+	if err != nil {
+		return err
+	}
+	c.restore(items)
+	return nil
+}
+
+// MarshalJSON serialize the data of all shards that is not expired with their expiration times
+// Each shard is read under its own read lock
+func (c *ShardedMapCache[E]) MarshalJSON() ([]byte, error) {
+	return JSONCodec{}.Marshal(c.snapshot())
+}
+
+// UnmarshalJSON set the data serialized by MarshalJSON to their shards
+func (c *ShardedMapCache[E]) UnmarshalJSON(data []byte) error {
+	items, err := decodeSnapshot[string, E](bytes.NewReader(data), JSONCodec{})
+	if err != nil {
+		return err
+	}
+	c.restore(items)
+	return nil
+}
+
+// copy the data of all shards that is not expired
+func (c *ShardedMapCache[E]) snapshot() map[string]*Item[E] {
+	items := make(map[string]*Item[E])
+	for _, shard := range c.shards {
+		for k, v := range shard.snapshot() {
+			items[k] = v
+		}
+	}
+	return items
+}
+
+// set the data that is not expired to their shards
+func (c *ShardedMapCache[E]) restore(items map[string]*Item[E]) {
+	groups := make(map[*mapCache[string, E]]map[string]*Item[E])
+	for k, v := range items {
+		shard := c.shard(k)
+		if groups[shard] == nil {
+			groups[shard] = make(map[string]*Item[E])
+		}
+		groups[shard][k] = v
+	}
+	for shard, group := range groups {
+		shard.restore(group)
+	}
+}
+
+// Export get a copy of all data of all shards with their expiration times
+func (c *ShardedMapCache[E]) Export() []Entry[string, E] {
+	res := make([]Entry[string, E], 0)
+	for _, shard := range c.shards {
+		res = append(res, shard.Export()...)
+	}
+	return res
+}
+
+// Import set all entries to their shards with their expiration times
+func (c *ShardedMapCache[E]) Import(entries []Entry[string, E], skipExpired bool) {
+	groups := make(map[*mapCache[string, E]][]Entry[string, E])
+	for _, entry := range entries {
+		shard := c.shard(entry.Key)
+		groups[shard] = append(groups[shard], entry)
+	}
+	for shard, group := range groups {
+		shard.Import(group, skipExpired)
+	}
+}
+
+// Clone create a new independent sharded cache with a copy of the data of each shard and the same options
+func (c *ShardedMapCache[E]) Clone() (MapInterface[E], error) {
+	exp := c.shards[0].options
+	if exp.enableEvents {
+		exp.eventChan = make(chan CacheEvent[string, E], exp.eventBuffer)
+	}
+	res := &ShardedMapCache[E]{
+		shards: make([]*mapCache[string, E], 0, len(c.shards)),
+		hasher: c.hasher,
+		config: c.config,
+	}
+	for _, shard := range c.shards {
+		clone, err := shard.clone(exp)
+		if err != nil {
+			_ = res.Close()
+			return nil, err
+		}
+		res.shards = append(res.shards, clone)
+	}
+	runtime.SetFinalizer(res, func(m *ShardedMapCache[E]) {
+		_ = m.Close()
+	})
+	return res, nil
+}
+
+// DeleteByPrefix delete all data whose key starts with prefix, and return the number of data deleted
+func (c *ShardedMapCache[E]) DeleteByPrefix(prefix string) int {
+	count := 0
+	for _, shard := range c.shards {
+		count += deleteByPrefix(shard, prefix)
+	}
+	return count
+}
+
+// KeysWithPrefix get all keys that start with prefix
+func (c *ShardedMapCache[E]) KeysWithPrefix(prefix string) []string {
+	res := make([]string, 0)
+	for _, shard := range c.shards {
+		res = append(res, keysWithPrefix(shard, prefix)...)
+	}
+	return res
+}
+
+// FromMap set all data in m with the same ttl to their shards, each shard is locked once,
+// and the data of each shard is set in the order of the sorted keys
+func (c *ShardedMapCache[E]) FromMap(m map[string]E, ttl time.Duration) {
+	groups := make(map[*mapCache[string, E]][]string)
+	for _, k := range sortedKeys(m) {
+		shard := c.shard(k)
+		groups[shard] = append(groups[shard], k)
+	}
+	for shard, keys := range groups {
+		fromMap(shard, keys, m, ttl)
+	}
+}
@@ -0,0 +1,50 @@
+// Package cachetest provide helpers to test code that uses the cache package without waiting for real time:
+// a fake clock to pass to cache.WithClock, and RunGcNow to run gc without waiting for its ticker
+package cachetest
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock a fake cache.Clock that only moves when it is advanced, it is safe for concurrent use
+// It also implements cache.Sleeper, so the pauses set by cache.WithGcSleep advance the clock instead of sleeping
+type Clock struct {
+	now int64 // Unix microseconds
+}
+
+// NewClock create a clock that starts at start
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start.UnixNano() / 1e3}
+}
+
+// Now get the current time in Unix microseconds
+func (c *Clock) Now() int64 {
+	return atomic.LoadInt64(&c.now)
+}
+
+// Time get the current time
+func (c *Clock) Time() time.Time {
+	return time.UnixMicro(c.Now())
+}
+
+// Advance move the clock forward by d, a negative d moves it backward
+func (c *Clock) Advance(d time.Duration) {
+	atomic.AddInt64(&c.now, d.Microseconds())
+}
+
+// Sleep advance the clock by d without sleeping
+func (c *Clock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Sweeper a cache that deletes its expired data, all caches of the cache package implement it
+type Sweeper interface {
+	DeleteExpired() int
+}
+
+// RunGcNow run one expiration sweep of c synchronously, the same as one tick of gc, and return the number of data deleted
+// Combined with a Clock, it makes tests of expiration fast and deterministic
+func RunGcNow(c Sweeper) int {
+	return c.DeleteExpired()
+}
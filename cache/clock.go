@@ -0,0 +1,36 @@
+package cache
+
+import "time"
+
+// Clock the source of the current time used to generate and check expiration times
+type Clock interface {
+	// Now get the current time in Unix microseconds
+	Now() int64
+}
+
+// Sleeper a Clock that also controls the pauses of gc set by WithGcSleep, so that tests do not have to wait
+// If the clock set by WithClock does not implement it, time.Sleep is used
+type Sleeper interface {
+	Sleep(d time.Duration)
+}
+
+// the system clock, the default clock
+type systemClock struct{}
+
+func (systemClock) Now() int64 {
+	return time.Now().UnixNano() / 1e3
+}
+
+// get the current time in Unix microseconds
+func (c *mapCache[K, E]) now() int64 {
+	return c.clock.Now()
+}
+
+// pause for d with the clock if it implements Sleeper, otherwise with time.Sleep
+func (c *mapCache[K, E]) sleep(d time.Duration) {
+	if s, ok := c.clock.(Sleeper); ok {
+		s.Sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
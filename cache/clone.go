@@ -0,0 +1,43 @@
+package cache
+
+import "fmt"
+
+// Clone create a new independent cache with a copy of the data and the same options
+// Expired data that has not been cleaned up is skipped, the data keeps its expiration time
+// The clone has its own gc, persistence is disabled so that it does not overwrite the file of the cache
+// A custom eviction policy can not be shared, so the clone of a cache with one evicts in LRU order
+func (c *MapCache[E]) Clone() (MapInterface[E], error) {
+	exp := c.options
+	exp.eventChan = nil
+	res, err := c.clone(exp)
+	if err != nil {
+		return nil, err
+	}
+	return wrapMapCache(res), nil
+}
+
+// create a mapCache with the options and copy the data that is not expired into it
+// Persistence is disabled, so the clone does not touch the file of the cache
+func (c *mapCache[K, E]) clone(exp options) (*mapCache[K, E], error) {
+	exp.enablePersistence = false
+	exp.walPath = ""
+	exp.persistErrors = nil
+	if _, ok := exp.evictionPolicy.(policyTemplate); !ok {
+		exp.evictionPolicy = LRU
+	}
+	res, err := createMapCache[K, E](exp)
+	if err != nil {
+		return nil, fmt.Errorf("can not clone the cache: %w", err)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res.mu.Lock()
+	defer res.unlock()
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) {
+			res.store(k, res.repack(v.Object), v.Expiration)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// gzip writers and readers are reused since creating them allocates large buffers
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	gzipReaders sync.Pool
+)
+
+// compress the data with gzip, nil stays nil
+func compressBytes(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+	w.Reset(&buf)
+	_, _ = w.Write(value)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+// decompress the data compressed by compressBytes
+// Data that is not compressed, for example loaded from a file saved without compression, is returned as it is
+func decompressBytes(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	r, _ := gzipReaders.Get().(*gzip.Reader)
+	var err error
+	if r == nil {
+		r, err = gzip.NewReader(bytes.NewReader(value))
+	} else {
+		err = r.Reset(bytes.NewReader(value))
+	}
+	if err != nil {
+		return value
+	}
+	defer gzipReaders.Put(r)
+	res, err := io.ReadAll(r)
+	if err != nil {
+		return value
+	}
+	return res
+}
+
+// get the functions that compress and decompress the data, E must be []byte
+func newCompressor[E any]() (compress, decompress func(E) E, ok bool) {
+	if _, ok = any(*new(E)).([]byte); !ok {
+		return nil, nil, false
+	}
+	compress = func(value E) E {
+		return any(compressBytes(any(value).([]byte))).(E)
+	}
+	decompress = func(value E) E {
+		return any(decompressBytes(any(value).([]byte))).(E)
+	}
+	return compress, decompress, true
+}
@@ -0,0 +1,55 @@
+package cache
+
+import "time"
+
+// CacheConfig the effective options of a cache, see Config
+type CacheConfig struct {
+	Expiration         time.Duration  // default expiration time, DefaultExpiration means never expire
+	GcInterval         time.Duration  // interval of gc
+	SlidingExpiration  bool           // Get extends the expiration time, see WithSlidingExpiration
+	LazyExpiration     bool           // expired data is deleted when it is read, see WithLazyExpiration
+	MaxTTL             time.Duration  // upper bound of the time any data is cached, 0 means unlimited
+	PersistenceEnabled bool           // whether the data is persisted
+	PersistenceName    string         // prefix of the persistence file
+	PersistencePath    string         // folder of the persistence file
+	WALPath            string         // write-ahead log, empty means it is not enabled
+	MaxEntries         int            // maximum number of data, 0 means unlimited
+	MaxBytes           int64          // maximum total size of data, 0 means unlimited
+	FullPolicy         FullPolicy     // what to do when data is set into a full cache
+	EvictionPolicy     EvictionPolicy // order in which data is evicted
+	StatsEnabled       bool           // whether statistics are collected, see WithStats
+	EventsEnabled      bool           // whether changes of the data are sent to Events, see WithEvents
+}
+
+// get the effective options as a CacheConfig
+func (o *options) config() CacheConfig {
+	return CacheConfig{
+		Expiration:         o.expiration,
+		GcInterval:         o.gcInterval,
+		SlidingExpiration:  o.sliding,
+		LazyExpiration:     o.lazy,
+		MaxTTL:             o.maxTTL,
+		PersistenceEnabled: o.enablePersistence,
+		PersistenceName:    o.persistenceName,
+		PersistencePath:    o.persistencePath,
+		WALPath:            o.walPath,
+		MaxEntries:         o.maxEntries,
+		MaxBytes:           o.maxBytes,
+		FullPolicy:         o.fullPolicy,
+		EvictionPolicy:     o.evictionPolicy,
+		StatsEnabled:       o.enableStats,
+		EventsEnabled:      o.enableEvents,
+	}
+}
+
+// Config get a copy of the effective options of the cache, changing it does not affect the cache
+// The gc interval is the one in use, which is the expiration time if it is shorter than the interval set
+func (c *mapCache[K, E]) Config() CacheConfig {
+	return c.options.config()
+}
+
+// Config get a copy of the effective options of the cache, the maximum number and size of data are the totals
+// of all shards, the persistence file of each shard has the shard index appended to the persistence name
+func (c *ShardedMapCache[E]) Config() CacheConfig {
+	return c.config
+}
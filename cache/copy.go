@@ -0,0 +1,43 @@
+package cache
+
+// copy the data with the copier set by WithCopier, it returns the data itself if no copier is set
+func (c *mapCache[K, E]) copy(value E) E {
+	if c.copier == nil {
+		return value
+	}
+	return c.copier(value)
+}
+
+// get the form in which the data is stored: compressed if WithValueCompression is set, otherwise a copy
+func (c *mapCache[K, E]) pack(value E) E {
+	if c.compress != nil {
+		return c.compress(value)
+	}
+	return c.copy(value)
+}
+
+// get the data from its stored form for the caller: decompressed if WithValueCompression is set, otherwise a copy
+func (c *mapCache[K, E]) unpack(value E) E {
+	if c.decompress != nil {
+		return c.decompress(value)
+	}
+	return c.copy(value)
+}
+
+// decompress the stored data if WithValueCompression is set, it returns the data itself otherwise
+// It is used where the data was shared by reference before compression, such as callbacks and events
+func (c *mapCache[K, E]) inflate(value E) E {
+	if c.decompress != nil {
+		return c.decompress(value)
+	}
+	return value
+}
+
+// get the stored form of data that is already stored, for moving data inside the cache
+// Compressed data is never handed out or changed, so it is shared, otherwise it is copied
+func (c *mapCache[K, E]) repack(value E) E {
+	if c.compress != nil {
+		return value
+	}
+	return c.copy(value)
+}
@@ -0,0 +1,46 @@
+package cache
+
+import "time"
+
+// Entry a data of the cache with its key and expiration time, see Export and Import
+type Entry[K comparable, E any] struct {
+	Key              K
+	Value            E
+	ExpirationMicros int64 // expiration time in Unix microseconds, 0 means never expire
+}
+
+// ItemSpec a data with its ttl, see SetManyWithTTL
+// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+type ItemSpec[E any] struct {
+	Value E
+	TTL   time.Duration
+}
+
+// Export get a copy of all data with their expiration times
+// Expired data that has not been cleaned up is skipped
+func (c *mapCache[K, E]) Export() []Entry[K, E] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make([]Entry[K, E], 0, len(c.items))
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) {
+			res = append(res, Entry[K, E]{k, c.unpack(v.Object), v.Expiration})
+		}
+	}
+	return res
+}
+
+// Import set all entries with their expiration times under one lock, it overwrites the data if the key exists
+// If skipExpired is true, expired entries are skipped, otherwise they are set and cleaned up by GC
+func (c *mapCache[K, E]) Import(entries []Entry[K, E], skipExpired bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	now := c.now()
+	for _, entry := range entries {
+		if skipExpired && entry.ExpirationMicros != 0 && now > entry.ExpirationMicros {
+			continue
+		}
+		c.set(entry.Key, entry.Value, entry.ExpirationMicros)
+	}
+}
@@ -0,0 +1,18 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrKeyNotFound the data does not exist or expires, the errors returned for a missing key wrap it,
+// use errors.Is to check it
+var ErrKeyNotFound = errors.New("the data does not exist")
+
+// create the error of a missing key, it wraps ErrKeyNotFound
+func notFound(key any) error {
+	return fmt.Errorf("%w: %v", ErrKeyNotFound, key)
+}
+
+// ErrCacheFull the data is rejected because the cache is full and the full policy is RejectNew, see WithFullPolicy
+var ErrCacheFull = errors.New("the cache is full")
@@ -0,0 +1,53 @@
+package cache
+
+import "sync/atomic"
+
+// EventType the type of change of the data
+type EventType int
+
+const (
+	// EventSet the data is set
+	EventSet EventType = iota
+	// EventDelete the data is deleted, evicted because the cache is full, or removed by Clear
+	EventDelete
+	// EventExpire the expired data is cleaned up
+	EventExpire
+)
+
+// CacheEvent a change of the data, see Events
+type CacheEvent[K comparable, E any] struct {
+	Type  EventType
+	Key   K
+	Value E
+}
+
+// send an event with the data in its stored form without blocking, the event is dropped if the channel is full
+func (c *mapCache[K, E]) emit(typ EventType, key K, value E) {
+	if c.events == nil {
+		return
+	}
+	select {
+	case c.events <- CacheEvent[K, E]{typ, key, c.inflate(value)}:
+	default:
+		atomic.AddInt64(&c.droppedEvents, 1)
+	}
+}
+
+// get the event type of the data that leaves the cache
+func eventType(reason EvictionReason) EventType {
+	if reason == ReasonExpired {
+		return EventExpire
+	}
+	return EventDelete
+}
+
+// Events get the channel of changes of the data
+// It returns nil if WithEvents is not set, the channel is never closed
+func (c *mapCache[K, E]) Events() <-chan CacheEvent[K, E] {
+	return c.events
+}
+
+// DroppedEvents get the number of events dropped because the channel is full
+func (c *mapCache[K, E]) DroppedEvents() int64 {
+	return atomic.LoadInt64(&c.droppedEvents)
+}
@@ -0,0 +1,57 @@
+package cache
+
+// EvictionReason the reason why data leaves the cache
+type EvictionReason int
+
+const (
+	// ReasonExpired the data is expired and cleaned up
+	ReasonExpired EvictionReason = iota
+	// ReasonDeleted the data is deleted explicitly
+	ReasonDeleted
+	// ReasonCapacity the data is evicted because the cache is full
+	ReasonCapacity
+	// ReasonCleared the data is removed by Clear
+	ReasonCleared
+)
+
+// data removed from the cache, waiting for the eviction callback
+type evictedItem[K comparable, E any] struct {
+	key    K
+	value  E
+	reason EvictionReason
+}
+
+// record the removed data in its stored form, the eviction callback is called after the lock is released
+func (c *mapCache[K, E]) addEvicted(key K, value E, reason EvictionReason) {
+	if c.onEvicted == nil {
+		return
+	}
+	c.evicted = append(c.evicted, evictedItem[K, E]{key, c.inflate(value), reason})
+}
+
+// release the write lock, and then call the eviction callback for the data removed while holding it
+// so that the callback can access the cache again without deadlock
+func (c *mapCache[K, E]) unlock() {
+	evicted := c.evicted
+	c.evicted = nil
+	c.mu.Unlock()
+	for _, item := range evicted {
+		c.onEvicted(item.key, item.value, item.reason)
+	}
+}
+
+// release the write locks of several caches, and then call the eviction callbacks of all of them
+// so that a callback can access any of the caches without deadlock
+func unlockAll[K comparable, E any](caches ...*mapCache[K, E]) {
+	evicted := make([][]evictedItem[K, E], len(caches))
+	for i, c := range caches {
+		evicted[i] = c.evicted
+		c.evicted = nil
+		c.mu.Unlock()
+	}
+	for i, c := range caches {
+		for _, item := range evicted[i] {
+			c.onEvicted(item.key, item.value, item.reason)
+		}
+	}
+}
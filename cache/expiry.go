@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiry the expiration time of a key in the expiration heap
+type expiry[K comparable] struct {
+	key        K
+	expiration int64
+}
+
+// expiryHeap a min-heap of expiration times, so that the adaptive gc knows when the next data expires
+// Entries are not removed when the data is deleted or its expiration time changes, such stale entries
+// are skipped when they are popped, and dropped when the heap is rebuilt
+type expiryHeap[K comparable] []expiry[K]
+
+func (h expiryHeap[K]) Len() int           { return len(h) }
+func (h expiryHeap[K]) Less(i, j int) bool { return h[i].expiration < h[j].expiration }
+func (h expiryHeap[K]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *expiryHeap[K]) Push(x any) {
+	*h = append(*h, x.(expiry[K]))
+}
+
+func (h *expiryHeap[K]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// add the expiration time of the data to the heap, it does nothing if the adaptive gc is not enabled
+// The gc loop is woken up if the data expires before all other data
+func (c *mapCache[K, E]) schedule(key K, expiration int64) {
+	if !c.adaptiveGc || expiration == 0 {
+		return
+	}
+	earliest := len(c.expiries) == 0 || expiration < c.expiries[0].expiration
+	heap.Push(&c.expiries, expiry[K]{key, expiration})
+	// drop the stale entries once they outnumber the data
+	if len(c.expiries) > 2*len(c.items)+64 {
+		c.rebuildExpiries()
+	}
+	if earliest {
+		select {
+		case c.gcWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// rebuild the heap from the expiration times of all data
+func (c *mapCache[K, E]) rebuildExpiries() {
+	c.expiries = c.expiries[:0]
+	for k, v := range c.items {
+		if v.Expiration != 0 {
+			c.expiries = append(c.expiries, expiry[K]{k, v.Expiration})
+		}
+	}
+	heap.Init(&c.expiries)
+}
+
+// delete the data whose expiration time has passed by popping the heap, it does not scan all data
+// Data whose expiration time has been extended without a set, for example by sliding expiration, is pushed again
+func (c *mapCache[K, E]) deleteDue() {
+	c.mu.Lock()
+	defer c.unlock()
+	now := c.now()
+	grace := c.keepExpired().Microseconds()
+	for len(c.expiries) > 0 && now > c.expiries[0].expiration+grace {
+		e := heap.Pop(&c.expiries).(expiry[K])
+		item, ok := c.items[e.key]
+		switch {
+		case !ok || item.Expiration == 0:
+		case item.Expiration == e.expiration:
+			c.del(e.key, ReasonExpired)
+		case item.Expiration > e.expiration:
+			heap.Push(&c.expiries, expiry[K]{e.key, item.Expiration})
+		}
+	}
+}
+
+// get the time until the next data expires, at most the gc interval
+func (c *mapCache[K, E]) nextGc() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.expiries) == 0 {
+		return c.gcInterval
+	}
+	next := time.Duration(c.expiries[0].expiration+c.keepExpired().Microseconds()-c.now()+1) * time.Microsecond
+	if next < 0 {
+		return 0
+	}
+	if next > c.gcInterval {
+		return c.gcInterval
+	}
+	return next
+}
+
+// the gc loop of the adaptive gc, it wakes up when the next data expires instead of at a fixed interval,
+// and still scans all data every gc interval to clean up the keys cached as absent
+func (c *mapCache[K, E]) adaptiveGcLoop(stop <-chan bool, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(c.gcInterval)
+	defer ticker.Stop()
+	for {
+		timer := time.NewTimer(c.nextGc())
+		select {
+		case <-timer.C:
+			c.deleteDue()
+		case <-c.gcWake:
+		case <-ticker.C:
+			_ = c.DeleteExpired()
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"sort"
+	"time"
+)
+
+// ExpiryStatus the expiration state of a key, see ExpiryInfo
+type ExpiryStatus struct {
+	Exists    bool          // the data exists, including expired data that has not been cleaned up
+	Expired   bool          // the data is expired
+	ExpiresAt time.Time     // expiration time, the zero time.Time if the data never expires
+	Remaining time.Duration // time before the data expires, negative if it is expired, DefaultExpiration if it never expires
+}
+
+// ExpiryInfo get the expiration state of the data
+// Expired data that has not been cleaned up is reported with Expired and a negative Remaining,
+// it returns an error wrapping ErrKeyNotFound if the data does not exist
+func (c *mapCache[K, E]) ExpiryInfo(key K) (ExpiryStatus, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.items[key]
+	if !ok {
+		return ExpiryStatus{}, notFound(key)
+	}
+	if value.Expiration == 0 {
+		return ExpiryStatus{Exists: true, Remaining: DefaultExpiration}, nil
+	}
+	now := c.now()
+	return ExpiryStatus{
+		Exists:    true,
+		Expired:   value.expired(now),
+		ExpiresAt: time.UnixMicro(value.Expiration),
+		Remaining: time.Duration(value.Expiration-now) * time.Microsecond,
+	}, nil
+}
+
+// KeyExpiry a key and its expiration time, see OrderedByExpiry
+type KeyExpiry[K comparable] struct {
+	Key       K
+	ExpiresAt time.Time // the zero time.Time if the data never expires
+}
+
+// OrderedByExpiry get the keys ordered by expiration time from the soonest, the data that never expires comes last
+// Expired data that has not been cleaned up is skipped, it copies and sorts all keys under the read lock,
+// so it is O(n log n)
+func (c *mapCache[K, E]) OrderedByExpiry() []KeyExpiry[K] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make([]KeyExpiry[K], 0, len(c.items))
+	now := c.now()
+	for k, v := range c.items {
+		if v.expired(now) {
+			continue
+		}
+		var expiresAt time.Time
+		if v.Expiration != 0 {
+			expiresAt = time.UnixMicro(v.Expiration)
+		}
+		res = append(res, KeyExpiry[K]{k, expiresAt})
+	}
+	sortByExpiry(res)
+	return res
+}
+
+// sort the keys by expiration time from the soonest, the zero time means never expire and comes last
+func sortByExpiry[K comparable](keys []KeyExpiry[K]) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].ExpiresAt, keys[j].ExpiresAt
+		if a.IsZero() {
+			return false
+		}
+		return b.IsZero() || a.Before(b)
+	})
+}
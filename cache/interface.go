@@ -1,46 +1,333 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"io"
+	"time"
+)
 
-type Interface[E any] interface {
+// KeyInterface the common operations of caches whose key is of type K
+type KeyInterface[K comparable, E any] interface {
 	// IsExpired judge whether the data is expired
-	IsExpired(key string) (bool, error)
-	// DeleteExpired delete all expired data
-	DeleteExpired()
+	IsExpired(key K) (bool, error)
+	// ExpiryInfo get the expiration state of the data in one call: whether it exists and is expired,
+	// its expiration time and the remaining time, which is negative if it is expired
+	// Expired data that has not been cleaned up is reported, it returns an error wrapping ErrKeyNotFound if the data does not exist
+	ExpiryInfo(key K) (ExpiryStatus, error)
+	// DeleteExpired delete all expired data, and return the number of data deleted
+	DeleteExpired() int
 
 	// StartGc start gc
 	// After the expiration time is set, GC will be started automatically without manual GC
+	// It returns an error if gc is running, unless WithAutoGcIdempotent is set
 	StartGc() error
 	// StopGc stop gc
+	// It waits for the gc goroutine to exit, calling it when gc is stopped does nothing
 	StopGc() error
+	// IsGcRunning judge whether gc is running, it is true after StartGc and false after StopGc or Close
+	IsGcRunning() bool
+	// Close stop gc and persistence, and persist the data one last time if persistence is enabled
+	// It can be called repeatedly, after closing, the data can still be read and written in memory,
+	// but it is no longer persisted and gc can not be started again
+	Close() error
 
 	// Get  data
 	// When the data does not exist or expires, it will return nonexistence（false）
-	Get(key string) (E, bool)
+	// If a loader is set by WithLoader, it loads the data instead, and returns false if the loader returns an error
+	Get(key K) (E, bool)
+	// MustGet get data, it is the same as Get but returns an error wrapping ErrKeyNotFound instead of false
+	// when the data does not exist, expires or can not be loaded, use errors.Is to check it
+	MustGet(key K) (E, error)
+	// GetOrDefault get data, or def when the data does not exist, expires or can not be loaded
+	GetOrDefault(key K, def E) E
+	// Peek get data without recording an access, it is useful for diagnostic reads
+	// It does not promote the data in the lru order, extend its sliding expiration, count as a hit or call the loader
+	Peek(key K) (E, bool)
+	// GetLoad get data, or load and set data with the loader set by WithLoader when the data does not exist or expires
+	// Concurrent callers for the same key share a single load, and nothing is set if the loader returns an error
+	// It returns the error of the loader, or an error if no loader is set and the data does not exist
+	GetLoad(key K) (E, error)
 	// GetAndDelete get data and delete by key
-	GetAndDelete(key string) (E, bool)
+	GetAndDelete(key K) (E, bool)
 	// GetAndExpired  get data and expire by key
 	// It will be deleted at the next clearing. If the clearing capability is not enabled, it will never be deleted
-	GetAndExpired(key string) (E, bool)
-	// GetWithExpiration get expiration time
-	GetWithExpiration(key string) (E, time.Time, bool)
+	GetAndExpired(key K) (E, bool)
+	// GetStale get data, or data that has expired within the grace set by WithStaleWhileRevalidate
+	// stale is true if the data is expired but within the grace, so that the caller can refresh it
+	// Without WithStaleWhileRevalidate it is the same as Get
+	GetStale(key K) (value E, stale bool, ok bool)
+	// GetWithExpiration get data and its expiration time in one call
+	// When the data does not exist or expires, it will return nonexistence（false）
+	// The expiration time is the zero time.Time if the data never expires, use IsZero to tell
+	GetWithExpiration(key K) (E, time.Time, bool)
+	// TTL get the remaining time before the data expires
+	// It returns false if the data does not exist or expires, and DefaultExpiration if the data never expires
+	TTL(key K) (time.Duration, bool)
+	// Touch reset the expiration time of the data without changing the data
+	// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+	// It returns false if the data does not exist or expires, expired data can not be touched even if GC has not removed it yet
+	Touch(key K, ttl time.Duration) bool
+	// GetTouch get data and reset its expiration time to extend from now under one write lock,
+	// so that some reads slide the expiration time without WithSlidingExpiration
+	// An extend of 0 means the default expiration time, and a negative extend means never expire
+	// It returns false if the data does not exist or expires, the loader is not called
+	GetTouch(key K, extend time.Duration) (E, bool)
+	// ExpireAt set the absolute expiration time of the data without changing the data
+	// A zero at means never expire, and a past at expires the data immediately
+	// It returns false if the data does not exist or expires
+	ExpireAt(key K, at time.Time) bool
 
 	// Delete delete data by key
-	Delete(key string) (E, bool)
+	Delete(key K) (E, bool)
+
+	// Stats get the statistics of the cache
+	// It returns zero values if WithStats is not set
+	Stats() CacheStats
+	// Config get a copy of the effective options of the cache, changing it does not affect the cache
+	Config() CacheConfig
+	// ApproxBytes get the approximate total size of the data, including expired data that has not been cleaned up
+	// With WithSizer it is the total calculated by the sizer, otherwise strings and byte slices count their length,
+	// types of fixed size such as numbers and structs without pointers count their memory size, and other types return -1
+	ApproxBytes() int64
+	// Events get the channel of changes of the data: EventSet, EventDelete and EventExpire
+	// It returns nil if WithEvents is not set, the channel is never closed
+	Events() <-chan CacheEvent[K, E]
+	// DroppedEvents get the number of events dropped because the channel is full
+	DroppedEvents() int64
+	// OrderedByExpiry get the keys ordered by expiration time from the soonest, the data that never expires comes last
+	// Expired data that has not been cleaned up is skipped, it sorts all keys, so it is O(n log n)
+	OrderedByExpiry() []KeyExpiry[K]
+	// TopKeys get the n most accessed keys ordered from the most accessed, n less than or equal to 0 means all keys
+	// Only reads that find live data are counted, expired data that has not been cleaned up is skipped
+	// It returns nil if WithAccessTracking is not set, it scans all data, so it is O(n log n)
+	TopKeys(n int) []KeyCount[K]
+	// BottomKeys get the n least accessed keys ordered from the least accessed, n less than or equal to 0 means all keys
+	// It returns nil if WithAccessTracking is not set, it scans all data, so it is O(n log n)
+	BottomKeys(n int) []KeyCount[K]
 }
 
-type MapInterface[E any] interface {
-	Interface[E]
+// KeyMapInterface the operations of map caches whose key is of type K
+type KeyMapInterface[K comparable, E any] interface {
+	KeyInterface[K, E]
 
 	// Set  data by key，it will overwrite the data if the key exists
-	Set(key string, value E)
+	Set(key K, value E)
+	// SetReport set data by key like Set, and report whether it replaced data that exists
+	// Expired data that has not been cleaned up does not count, and it returns false if the data is rejected
+	SetReport(key K, value E) bool
 	// SetDefault  data by key，it will overwrite the data if the key exists
-	SetDefault(key string, value E, expiration time.Duration)
+	SetDefault(key K, value E, expiration time.Duration)
 	// Add data，Cannot add existing data
 	// To override the addition, use the set method
-	Add(key string, value E) error
-	// Clear remove all data
+	// Expired data that has not been cleaned up is treated as absent and overwritten
+	// It returns ErrCacheFull if the cache is full and the full policy set by WithFullPolicy is RejectNew
+	Add(key K, value E) error
+	// Replace replace the data only if the key exists and the data is not expired, otherwise it returns an error
+	// The expiration time is reset to the default expiration time
+	Replace(key K, value E) error
+	// ReplaceKeepTTL replace the data only if the key exists and the data is not expired, otherwise it returns an error
+	// Unlike Replace, the expiration time is not changed
+	ReplaceKeepTTL(key K, value E) error
+	// CompareAndSwap replace the data with newValue only if the data exists and is equal to oldValue judged by eq
+	// The expiration time is not changed, it returns whether the data is replaced,
+	// which is false if newValue is rejected because the cache is full, see WithFullPolicy
+	CompareAndSwap(key K, oldValue, newValue E, eq func(a, b E) bool) bool
+	// CompareAndDelete delete the data only if the data exists and is equal to oldValue judged by eq
+	// It returns whether the data is deleted
+	CompareAndDelete(key K, oldValue E, eq func(a, b E) bool) bool
+	// Update read, modify and write the data under one write lock, so that the update is atomic
+	// fn gets the data and whether it exists, and returns the new data and whether to set it. The expiration time of
+	// the data is not changed, new data gets the default expiration time. fn must not access the cache, it deadlocks
+	// It returns the data after the update and whether it is set
+	Update(key K, fn func(old E, exists bool) (E, bool)) (E, bool)
+	// SetWithTTL  data by key with ttl，it will overwrite the data if the key exists
+	// A ttl greater than 0 expires the data ttl after now, a ttl of 0 means the default expiration time set by
+	// SetExpirationTime, so the data never expires if it is DefaultExpiration, and a negative ttl means never expire
+	SetWithTTL(key K, value E, ttl time.Duration)
+	// SetWithTTLReport set data by key with ttl like SetWithTTL, and report the expiration time stored for the data
+	// The time is zero if the data never expires, it returns false if the data is rejected because the cache is full
+	SetWithTTLReport(key K, value E, ttl time.Duration) (time.Time, bool)
+	// SetExpireAt set data by key with an absolute expiration time, it will overwrite the data if the key exists
+	// A zero at means never expire, and a past at expires the data immediately
+	SetExpireAt(key K, value E, at time.Time)
+	// AddWithTTL add data with ttl，Cannot add existing data
+	// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+	AddWithTTL(key K, value E, ttl time.Duration) error
+	// SetIfAbsent set data with ttl only if the data does not exist or expires, and return whether it is set
+	// Expired data that has not been cleaned up is overwritten
+	// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+	SetIfAbsent(key K, value E, ttl time.Duration) bool
+	// GetOrSet get data, or set data when the data does not exist or expires
+	// It returns true if the data exists, otherwise it returns the value that was set and false
+	// It returns ErrCacheFull if the data does not exist and value is rejected because the cache is full, see WithFullPolicy
+	GetOrSet(key K, value E) (E, bool, error)
+	// GetAndSet set data by key and return the previous data under one lock
+	// It returns false if the previous data does not exist or expires, the new data gets the default expiration time
+	// It returns ErrCacheFull and keeps the previous data if value is rejected because the cache is full, see WithFullPolicy
+	GetAndSet(key K, value E) (E, bool, error)
+	// Rename move the data to newKey under one lock, keeping its value and expiration time
+	// It returns false if the data of oldKey does not exist or expires, the data of newKey is overwritten if it exists
+	Rename(oldKey, newKey K) bool
+	// SetMiss cache the fact that the key does not exist, so that repeated misses do not hit the backing store
+	// The data of the key is deleted, and the miss is forgotten when the key is set or deleted
+	// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+	SetMiss(key K, ttl time.Duration)
+	// GetWithStatus get data and the state of the key: StatusHit if the data exists,
+	// StatusMiss if the key is cached as absent by SetMiss, otherwise StatusUnknown
+	// Get returns nonexistence（false）for both StatusMiss and StatusUnknown
+	GetWithStatus(key K) (E, Status)
+	// GetOrCompute get data, or compute and set data when the data does not exist or expires
+	// fn is only called on a miss and is called under the lock of the key, so it is computed exactly once,
+	// computations for different keys run in parallel and other operations on the cache are not blocked
+	// fn must not call GetOrCompute with the same key, otherwise it deadlocks
+	// If fn returns an error, nothing is set
+	GetOrCompute(key K, fn func() (E, error)) (E, error)
+	// SetMany set all data in items with the default expiration time under one lock
+	// it will overwrite the data if the key exists
+	SetMany(items map[K]E)
+	// SetManyWithTTL set all data in entries with their own ttl under one lock
+	// it will overwrite the data if the key exists
+	// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+	SetManyWithTTL(entries map[K]ItemSpec[E])
+	// GetMany get data of keys under one lock
+	// Data that does not exist or expires is omitted from the result
+	GetMany(keys []K) map[K]E
+	// GetManyCtx get data of keys, and load the data that does not exist or expires with the loader set by WithLoader
+	// The loads run in parallel without holding the lock, data that can not be loaded is omitted from the result
+	// When ctx is done, it stops waiting and returns the data resolved so far with ctx.Err()
+	GetManyCtx(ctx context.Context, keys []K) (map[K]E, error)
+	// WaitGet get data, or block until the data is set when it does not exist or expires
+	// It returns ctx.Err() if ctx is done before the data is set, the loader is not called
+	WaitGet(ctx context.Context, key K) (E, error)
+	// SetWithTags set data by key with the default expiration time and attach tags to it, see InvalidateTag
+	// it will overwrite the data and its tags if the key exists, setting the data again without tags removes its tags
+	// Tags are kept in memory only, they are not persisted or cloned
+	SetWithTags(key K, value E, tags ...string)
+	// InvalidateTag delete all data carrying tag, and return the number of data deleted
+	// Expired data that carries tag is also removed but not counted, data that leaves the cache is removed from its tags
+	InvalidateTag(tag string) int
+	// DeleteWhere delete all data for which pred returns true under one lock, and return the number of data deleted
+	// The eviction callback is called for each data deleted. Expired data that has not been cleaned up is skipped,
+	// pred is called under the write lock, it must not call back into the cache, otherwise it deadlocks
+	DeleteWhere(pred func(key K, value E) bool) int
+	// GetAndDeleteMany get data of keys and delete them under one lock, so that each data is returned to only one caller
+	// Data that does not exist or expires is omitted from the result
+	GetAndDeleteMany(keys []K) map[K]E
+	// DeleteMany delete data of keys under one lock
+	DeleteMany(keys []K)
+	// Range call fn for each data, it stops if fn returns false
+	// Expired data that has not been cleaned up is skipped
+	// fn is called under the read lock, it must not call back into the cache, otherwise it may deadlock
+	Range(fn func(key K, value E) bool)
+	// Items get a copy of all data
+	// Expired data that has not been cleaned up is skipped, changing the result does not affect the cache
+	Items() map[K]E
+	// GetOrComputeCtx get data, or compute and set data when the data does not exist or expires
+	// Concurrent callers for the same key share a single computation, which runs without holding the lock,
+	// so other keys are not blocked. fn is called with the ctx of the caller that starts the computation,
+	// and each caller stops waiting and returns ctx.Err() when its own ctx is done
+	// If fn returns an error, nothing is set
+	GetOrComputeCtx(ctx context.Context, key K, fn func(context.Context) (E, error)) (E, error)
+	// Flush write the data to the persistence file immediately instead of waiting for the next backup
+	// Expired data that has not been cleaned up is skipped,
+	// it returns an error if persistence is not enabled or the cache is closed
+	// It is safe to call while the data is backed up periodically
+	Flush() error
+	// CompactAndFlush delete all expired data and write the rest to the persistence file under one write lock,
+	// so that no data can be set in between and the file only holds the data that is not expired
+	// It returns an error if persistence is not enabled or the cache is closed
+	CompactAndFlush() error
+	// PersistErrors get the channel of the errors of the periodic backup and of appending to the write-ahead log,
+	// so that failed backups and changes missing from the log can be observed
+	// The channel keeps the latest 16 errors, older errors are dropped when it is full. It returns nil if persistence
+	// is not enabled, the channel is never closed. Errors of Flush and Close are returned by them instead
+	PersistErrors() <-chan error
+	// Save write a snapshot of the data to w with the persistence codec
+	// Expired data that has not been cleaned up is skipped
+	Save(w io.Writer) error
+	// Load read a snapshot of the data from r with the persistence codec, and set the data
+	// It overwrites the data if the key exists, expired data in the snapshot is skipped
+	Load(r io.Reader) error
+	// MarshalJSON serialize the data that is not expired with their expiration times under the read lock,
+	// so that the cache can be dumped with json.Marshal
+	MarshalJSON() ([]byte, error)
+	// UnmarshalJSON set the data serialized by MarshalJSON, so that a cache can be filled with json.Unmarshal
+	// It overwrites the data if the key exists, expired data is skipped
+	UnmarshalJSON(data []byte) error
+	// Export get a copy of all data with their expiration times, it is the same as Save without serialization
+	// Expired data that has not been cleaned up is skipped
+	Export() []Entry[K, E]
+	// Import set all entries with their expiration times under one lock, it is the same as Load without serialization
+	// It overwrites the data if the key exists. If skipExpired is true, expired entries are skipped,
+	// otherwise they are set and cleaned up by GC
+	Import(entries []Entry[K, E], skipExpired bool)
+	// Clear remove all data, the lock is held for O(1) time,
+	// the eviction callback and the events of the removed data are handled after the lock is released
 	Clear()
 	// Keys get all keys
+	// Expired data that has not been cleaned up is skipped
+	Keys() []K
+	// Len get the number of data
+	// Expired data that has not been cleaned up is not counted, it scans all data, so it is O(n)
+	Len() int
+}
+
+type Interface[E any] interface {
+	KeyInterface[string, E]
+}
+
+type MapInterface[E any] interface {
+	KeyMapInterface[string, E]
+
+	// DeleteByPrefix delete all data whose key starts with prefix, and return the number of data deleted
+	// Expired data that matches is also removed but not counted
+	// An empty prefix matches all data, it scans all data, so it is O(n)
+	DeleteByPrefix(prefix string) int
+	// KeysWithPrefix get all keys that start with prefix
+	// Expired data that has not been cleaned up is skipped, an empty prefix matches all data, it scans all data, so it is O(n)
+	KeysWithPrefix(prefix string) []string
+	// FromMap set all data in m with the same ttl under one lock, in the order of the sorted keys,
+	// so that the insertion order, and so the eviction order with the FIFO policy, is deterministic
+	// It overwrites the data if the key exists. A ttl of 0 means the default expiration time, and a negative ttl means never expire
+	FromMap(m map[string]E, ttl time.Duration)
+	// Clone create a new independent cache with a copy of the data and the same options
+	// Expired data that has not been cleaned up is skipped, the data keeps its expiration time
+	// The clone has its own gc, persistence is disabled so that it does not overwrite the file of the cache
+	// It returns an error instead of a clone if the cache can not be created with the options
+	Clone() (MapInterface[E], error)
+	// ReadOnly get a read-only view of the cache, it shares the data with the cache
+	// Pass it to code that should only read, the view can not be converted back to the cache by a type assertion
+	ReadOnly() ReadOnlyMap[E]
+}
+
+// ReadOnlyMap the read operations of a map cache, see ReadOnly
+type ReadOnlyMap[E any] interface {
+	// Get  data
+	// When the data does not exist or expires, it will return nonexistence（false）
+	Get(key string) (E, bool)
+	// GetWithExpiration get data and its expiration time in one call
+	// The expiration time is the zero time.Time if the data never expires
+	GetWithExpiration(key string) (E, time.Time, bool)
+	// TTL get the remaining time before the data expires
+	// It returns false if the data does not exist or expires, and DefaultExpiration if the data never expires
+	TTL(key string) (time.Duration, bool)
+	// Len get the number of data
+	Len() int
+	// Keys get all keys
 	Keys() []string
+	// Range call fn for each data, it stops if fn returns false
+	Range(fn func(key string, value E) bool)
+}
+
+type NumberMapInterface[E Number] interface {
+	MapInterface[E]
+
+	// Increment add delta to the data and return the new value, the expiration time is not changed
+	// When the data does not exist or expires, it returns an error,
+	// or sets the data to delta with the default expiration time if WithCreateOnIncrement is set
+	Increment(key string, delta E) (E, error)
+	// Decrement subtract delta from the data and return the new value, the expiration time is not changed
+	// When the data does not exist or expires, it returns an error,
+	// or sets the data to -delta with the default expiration time if WithCreateOnIncrement is set
+	Decrement(key string, delta E) (E, error)
 }
@@ -1,23 +1,51 @@
 package cache
 
-import (
-	"time"
-)
+import "time"
 
 type Item[E any] struct {
-	Object     E     // data
-	Expiration int64 // expiration time
+	Object     E        // data
+	Expiration int64    // expiration time in Unix microseconds, 0 means never expire
+	size       int64    // approximate size of the data
+	cost       int64    // cost of recomputing the data, only used when the cost function is set
+	hits       int64    // number of reads of the data, only used when access tracking is enabled
+	tags       []string // tags of the data, see SetWithTags
 }
 
-// judge whether data is expired
-func (item *Item[E]) expired() bool {
+// Value get the data
+func (item *Item[E]) Value() E {
+	return item.Object
+}
+
+// ExpiresAt get the expiration time, the zero time.Time if the data never expires
+func (item *Item[E]) ExpiresAt() time.Time {
+	if item.Expiration == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(item.Expiration)
+}
+
+// TTL get the remaining time before the data expires by the system clock, negative if it is expired
+// It returns DefaultExpiration if the data never expires
+func (item *Item[E]) TTL() time.Duration {
+	if item.Expiration == 0 {
+		return DefaultExpiration
+	}
+	return time.Until(item.ExpiresAt())
+}
+
+// judge whether data is expired at now
+// The expiration time and now are in microseconds, the same unit as generateExpiration and Clock
+func (item *Item[E]) expired(now int64) bool {
 	if item.Expiration == 0 {
 		return false
 	}
-	return time.Now().UnixNano()/1e3 > item.Expiration
+	return now > item.Expiration
 }
 
-// SetDefault the expiration time, and the data will be cleared in the next cache cleaning cycle
-func (item *Item[E]) setExpired() {
-	item.Expiration = time.Now().UnixNano() / 1e3
+// judge whether data has been expired for longer than grace at now
+func (item *Item[E]) expiredFor(now int64, grace time.Duration) bool {
+	if item.Expiration == 0 {
+		return false
+	}
+	return now > item.Expiration+grace.Microseconds()
 }
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"github.com/lomtom/go-utils/assert"
+	"testing"
+	"time"
+)
+
+func TestItemExpired(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := createMapCache[string, int](newOption())
+	a.Equal(nil, err)
+	item := &Item[int]{Expiration: c.generateExpirationForItem(time.Millisecond * 50)}
+	a.Equal(false, item.expired(c.now()))
+	time.Sleep(time.Millisecond * 60)
+	a.Equal(true, item.expired(c.now()))
+
+	item = &Item[int]{}
+	a.Equal(false, item.expired(c.now()))
+}
+
+func TestItemAccessors(t *testing.T) {
+	a := assert.NewAssert(t)
+	expiresAt := time.Now().Add(time.Hour)
+	item := &Item[int]{Object: 1, Expiration: expiresAt.UnixMicro()}
+	a.Equal(1, item.Value())
+	a.Equal(expiresAt.UnixMicro(), item.ExpiresAt().UnixMicro())
+	a.Equal(true, item.TTL() > time.Hour-time.Second && item.TTL() <= time.Hour)
+
+	item = &Item[int]{Object: 2, Expiration: time.Now().Add(-time.Minute).UnixMicro()}
+	a.Equal(true, item.TTL() < 0)
+
+	item = &Item[int]{Object: 3}
+	a.Equal(3, item.Value())
+	a.Equal(true, item.ExpiresAt().IsZero())
+	a.Equal(DefaultExpiration, item.TTL())
+}
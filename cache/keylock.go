@@ -0,0 +1,44 @@
+package cache
+
+import "sync"
+
+// keyLocks holds a mutex for each key in use, so that work on different keys does not block each other
+// The mutex of a key is removed when no one holds or waits for it
+type keyLocks[K comparable] struct {
+	mu    sync.Mutex
+	locks map[K]*keyLock
+}
+
+// a mutex of a key, refs is the number of goroutines holding or waiting for it
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock the key
+func (l *keyLocks[K]) lock(key K) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[K]*keyLock)
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+	kl.mu.Lock()
+}
+
+// unlock the key
+func (l *keyLocks[K]) unlock(key K) {
+	l.mu.Lock()
+	kl := l.locks[key]
+	kl.refs--
+	if kl.refs == 0 {
+		delete(l.locks, key)
+	}
+	l.mu.Unlock()
+	kl.mu.Unlock()
+}
@@ -0,0 +1,163 @@
+package cache
+
+// FullPolicy what to do when data is set into a cache that is full, see WithFullPolicy
+type FullPolicy int
+
+const (
+	// EvictLRU evict the least recently used data to make room, or the cheapest data if the cost function is set
+	EvictLRU FullPolicy = iota
+	// RejectNew reject the data, Set drops it and Add returns ErrCacheFull
+	RejectNew
+)
+
+// init the eviction policy and the size of the data loaded from persistence
+// The policy is only used if the number or the size of data is limited
+func (c *mapCache[K, E]) initPolicy() {
+	for _, v := range c.items {
+		v.size = c.sizeOf(v.Object)
+		v.cost = c.costOf(v.Object)
+		c.bytes += v.size
+	}
+	if c.maxEntries <= 0 && c.maxBytes <= 0 {
+		return
+	}
+	c.policy = c.evictionPolicy
+	if template, ok := c.policy.(policyTemplate); ok {
+		c.policy = template.newPolicy()
+	}
+	for k := range c.items {
+		c.policy.RecordInsert(k)
+	}
+	c.evictOverCapacity()
+}
+
+// record new data in the eviction policy, and evict data if the cache is full
+func (c *mapCache[K, E]) recordInsert(key K) {
+	if c.policy == nil {
+		return
+	}
+	c.policy.RecordInsert(key)
+	c.evictOverCapacity()
+}
+
+// record a read or an overwrite of the data in the eviction policy
+func (c *mapCache[K, E]) recordAccess(key K) {
+	if c.policy != nil {
+		c.policy.RecordAccess(key)
+	}
+}
+
+// record in the eviction policy that the data leaves the cache
+func (c *mapCache[K, E]) recordRemove(key K) {
+	if c.policy != nil {
+		c.policy.RecordRemove(key)
+	}
+}
+
+// get the approximate size of the data, 1 if no sizer is set
+func (c *mapCache[K, E]) sizeOf(value E) int64 {
+	if c.sizer == nil {
+		return 1
+	}
+	return c.sizer(value)
+}
+
+// judge whether the data is rejected because the cache is full, only when the full policy is RejectNew
+// Overwriting data is rejected only if it makes the size of data exceed the limit
+func (c *mapCache[K, E]) rejects(key K, size int64) bool {
+	if c.fullPolicy != RejectNew {
+		return false
+	}
+	item, ok := c.items[key]
+	if !ok && c.maxEntries > 0 && len(c.items) >= c.maxEntries {
+		return true
+	}
+	if c.maxBytes <= 0 {
+		return false
+	}
+	bytes := c.bytes + size
+	if ok {
+		bytes -= item.size
+	}
+	return bytes > c.maxBytes
+}
+
+// judge whether the number or the size of the data exceeds the limit
+func (c *mapCache[K, E]) overCapacity() bool {
+	if c.maxEntries > 0 && len(c.items) > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes > c.maxBytes
+}
+
+// evict data until the cache is no longer over capacity
+// Data larger than the byte limit is evicted as soon as it is set
+func (c *mapCache[K, E]) evictOverCapacity() {
+	if c.policy == nil {
+		return
+	}
+	for c.overCapacity() && c.evict() {
+	}
+}
+
+// evict the data chosen by the eviction policy, it returns false if there is no data
+// If the cost function is set, the data with the lowest cost is evicted instead,
+// and the one the policy would evict first among the data with the same cost
+// Keys chosen by the policy that are not in the cache are removed from it and skipped, if the policy has
+// no key of the cache left, any data is evicted, so that the cache never stays over capacity
+func (c *mapCache[K, E]) evict() bool {
+	if c.cost != nil {
+		if key, ok := c.cheapest(); ok {
+			c.del(key, ReasonCapacity)
+			return true
+		}
+		return false
+	}
+	// each attempt either finds a key of the cache or removes a stale key from the policy
+	for i := 0; i <= len(c.items); i++ {
+		victim, ok := c.policy.Evict()
+		if !ok {
+			break
+		}
+		if key, ok := victim.(K); ok {
+			if _, ok = c.items[key]; ok {
+				c.del(key, ReasonCapacity)
+				return true
+			}
+		}
+		c.policy.RecordRemove(victim)
+	}
+	for key := range c.items {
+		c.del(key, ReasonCapacity)
+		return true
+	}
+	return false
+}
+
+// get the cost of the data, 0 if no cost function is set
+func (c *mapCache[K, E]) costOf(value E) int64 {
+	if c.cost == nil {
+		return 0
+	}
+	return c.cost(value)
+}
+
+// find the data with the lowest cost, scanning in the order of the eviction policy
+// It scans all data, so it is O(n)
+func (c *mapCache[K, E]) cheapest() (K, bool) {
+	var res K
+	var lowest int64
+	found := false
+	c.policy.(orderedPolicy).each(func(victim any) bool {
+		key, ok := victim.(K)
+		if !ok {
+			return true
+		}
+		item, ok := c.items[key]
+		if ok && (!found || item.cost < lowest) {
+			res, lowest, found = key, item.cost, true
+		}
+		return true
+	})
+	return res, found
+}
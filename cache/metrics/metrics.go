@@ -0,0 +1,75 @@
+// Package metrics publish the statistics of caches as Prometheus metrics
+// It is a module of its own, so that the cache package stays dependency-free:
+//
+//	go get github.com/lomtom/go-utils/cache/metrics
+package metrics
+
+import (
+	"github.com/lomtom/go-utils/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatsProvider a cache whose statistics are published, all caches of the cache package implement it
+type StatsProvider interface {
+	Stats() cache.CacheStats
+}
+
+// RegisterMetrics register the statistics of c with reg, the metrics are named namespace_cache_*
+// The statistics are read on every scrape, c must be created with cache.WithStats, otherwise all metrics are 0
+// Register caches with different namespaces, otherwise reg returns an error for the duplicate metrics
+// The bytes gauge is the size calculated by the sizer of cache.WithSizer, each data counts as 1 if the cache has
+// no sizer, so that it is the same as the entries gauge
+func RegisterMetrics(namespace string, reg prometheus.Registerer, c StatsProvider) error {
+	return reg.Register(newCollector(namespace, c))
+}
+
+// collector read the statistics of the cache when it is collected
+type collector struct {
+	cache     StatsProvider
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	sets      *prometheus.Desc
+	evictions *prometheus.Desc
+	deletes   *prometheus.Desc
+	entries   *prometheus.Desc
+	bytes     *prometheus.Desc
+}
+
+func newCollector(namespace string, c StatsProvider) *collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", name), help, nil, nil)
+	}
+	return &collector{
+		cache:     c,
+		hits:      desc("hits_total", "Number of reads that found live data."),
+		misses:    desc("misses_total", "Number of reads that found no data or expired data."),
+		sets:      desc("sets_total", "Number of data written."),
+		evictions: desc("evictions_total", "Number of data removed because it expired or the cache is full."),
+		deletes:   desc("deletes_total", "Number of data removed explicitly, including Clear."),
+		entries:   desc("entries", "Number of data, including expired data that has not been cleaned up."),
+		bytes:     desc("bytes", "Approximate size of data calculated by the sizer, or the number of data if the cache has no sizer."),
+	}
+}
+
+// Describe implement prometheus.Collector
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.sets
+	ch <- c.evictions
+	ch <- c.deletes
+	ch <- c.entries
+	ch <- c.bytes
+}
+
+// Collect implement prometheus.Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.sets, prometheus.CounterValue, float64(stats.Sets))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.deletes, prometheus.CounterValue, float64(stats.Deletes))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(stats.Bytes))
+}
@@ -0,0 +1,53 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/lomtom/go-utils/assert"
+	"github.com/lomtom/go-utils/cache"
+	"github.com/lomtom/go-utils/cache/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.WithStats())
+	a.Equal(nil, err)
+	reg := prometheus.NewRegistry()
+	a.Equal(nil, metrics.RegisterMetrics("app", reg, c))
+	a.Equal(false, metrics.RegisterMetrics("app", reg, c) == nil)
+
+	gather := func() map[string]float64 {
+		families, err := reg.Gather()
+		a.Equal(nil, err)
+		res := make(map[string]float64)
+		for _, family := range families {
+			metric := family.GetMetric()[0]
+			if metric.GetCounter() != nil {
+				res[family.GetName()] = metric.GetCounter().GetValue()
+			} else {
+				res[family.GetName()] = metric.GetGauge().GetValue()
+			}
+		}
+		return res
+	}
+	a.Equal(map[string]float64{
+		"app_cache_hits_total":      0,
+		"app_cache_misses_total":    0,
+		"app_cache_sets_total":      0,
+		"app_cache_evictions_total": 0,
+		"app_cache_deletes_total":   0,
+		"app_cache_entries":         0,
+		"app_cache_bytes":           0,
+	}, gather())
+
+	c.Set("1", 1)
+	c.Get("1")
+	c.Get("2")
+	res := gather()
+	a.Equal(float64(1), res["app_cache_hits_total"])
+	a.Equal(float64(1), res["app_cache_misses_total"])
+	a.Equal(float64(1), res["app_cache_entries"])
+	// each data counts as 1 without a sizer
+	a.Equal(float64(1), res["app_cache_bytes"])
+}
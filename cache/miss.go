@@ -0,0 +1,54 @@
+package cache
+
+import "time"
+
+// Status the state of a key in the cache, see GetWithStatus
+type Status int
+
+const (
+	// StatusUnknown the cache knows nothing about the key
+	StatusUnknown Status = iota
+	// StatusHit the data exists and is not expired
+	StatusHit
+	// StatusMiss the key is cached as known to be absent by SetMiss
+	StatusMiss
+)
+
+// SetMiss cache the fact that the key does not exist, so that repeated misses do not hit the backing store
+// The data of the key is deleted, and the miss is forgotten when the key is set or deleted
+// A ttl of 0 means the default expiration time, and a negative ttl means never expire
+func (c *mapCache[K, E]) SetMiss(key K, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.del(key, ReasonDeleted)
+	if c.misses == nil {
+		c.misses = make(map[K]*Item[struct{}])
+	}
+	c.misses[key] = &Item[struct{}]{Expiration: c.generateExpirationWithTTL(ttl)}
+}
+
+// GetWithStatus get data and the state of the key
+// It distinguishes data that exists, a key cached as absent by SetMiss, and a key the cache knows nothing about
+func (c *mapCache[K, E]) GetWithStatus(key K) (E, Status) {
+	c.mu.Lock()
+	defer c.unlock()
+	if item, ok := c.lookup(key); ok {
+		c.access(key, item)
+		return c.unpack(item.Object), StatusHit
+	}
+	var zero E
+	if miss, ok := c.misses[key]; ok && !miss.expired(c.now()) {
+		return zero, StatusMiss
+	}
+	return zero, StatusUnknown
+}
+
+// delete the expired misses
+func (c *mapCache[K, E]) deleteExpiredMisses() {
+	now := c.now()
+	for k, v := range c.misses {
+		if v.expired(now) {
+			delete(c.misses, k)
+		}
+	}
+}
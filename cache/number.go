@@ -0,0 +1,74 @@
+package cache
+
+// Number the data type that supports Increment and Decrement
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+type NumberMapCache[E Number] struct {
+	*MapCache[E]
+}
+
+// NewNumberMapCache create a cache with mapCache for numeric data
+func NewNumberMapCache[E Number](opts ...CreateOptionFunc) (NumberMapInterface[E], error) {
+	c, err := newMapCache[E](opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &NumberMapCache[E]{c}, nil
+}
+
+// Increment add delta to the data and return the new value, the expiration time is not changed
+// When the data does not exist or expires, it returns an error,
+// or sets the data to delta with the default expiration time if WithCreateOnIncrement is set
+// It returns ErrCacheFull and keeps the data if the new value is rejected, see WithFullPolicy
+func (c *NumberMapCache[E]) Increment(key string, delta E) (E, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.get(key)
+	if !ok {
+		if !c.createOnIncrement {
+			var zero E
+			return zero, notFound(key)
+		}
+		if !c.set(key, delta, c.generateExpiration()) {
+			var zero E
+			return zero, ErrCacheFull
+		}
+		return delta, nil
+	}
+	// the new value is set like any write, so that it reaches the write-ahead log, the events and the statistics
+	res := value.Object + delta
+	if !c.set(key, res, value.Expiration) {
+		return value.Object, ErrCacheFull
+	}
+	return res, nil
+}
+
+// Decrement subtract delta from the data and return the new value, the expiration time is not changed
+// When the data does not exist or expires, it returns an error,
+// or sets the data to -delta with the default expiration time if WithCreateOnIncrement is set
+// It returns ErrCacheFull and keeps the data if the new value is rejected, see WithFullPolicy
+func (c *NumberMapCache[E]) Decrement(key string, delta E) (E, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	value, ok := c.get(key)
+	if !ok {
+		if !c.createOnIncrement {
+			var zero E
+			return zero, notFound(key)
+		}
+		var zero E
+		if !c.set(key, zero-delta, c.generateExpiration()) {
+			return zero, ErrCacheFull
+		}
+		return zero - delta, nil
+	}
+	res := value.Object - delta
+	if !c.set(key, res, value.Expiration) {
+		return value.Object, ErrCacheFull
+	}
+	return res, nil
+}
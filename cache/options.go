@@ -1,6 +1,11 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
 
 const (
 	// DefaultExpiration Default expiration time flag， never expires
@@ -17,6 +22,26 @@ const (
 type expirationOption struct {
 	expiration time.Duration // Expiration time
 	gcInterval time.Duration // Overdue data Item cleaning cycle
+	gcEnabled  bool          // The gc interval is set by WithGcInterval, gc is started even if the data never expires by default
+	// The gc interval is set by SetGcInterval or WithGcInterval, so it does not follow the expiration time
+	gcIntervalSet bool
+	sliding       bool          // Extend the expiration time on every Get
+	jitter        float64       // Randomize the default expiration time within ±jitter of it
+	staleGrace    time.Duration // Keep expired data for GetStale for this long after it expires
+	clock         Clock         // Source of the current time
+	// Number of data scanned by DeleteExpired before the lock is released, 0 means the whole map is scanned at once
+	gcBatchSize  int
+	gcSleep      time.Duration // Pause of gc between batches, so that gc yields the CPU
+	adaptiveGc   bool          // Wake gc up when the next data expires
+	idempotentGc bool          // StartGc does nothing instead of returning an error when gc is running
+	lazy         bool          // Gc is not started, expired data is deleted when it is read
+	// Upper bound of the time any data is cached, 0 means unlimited
+	maxTTL time.Duration
+	// Reload the data in the background when it is read within this long before it expires, 0 means disabled
+	refreshAhead time.Duration
+	// Serve the expired data kept for staleErrorGrace when the loader fails
+	serveStale      bool
+	staleErrorGrace time.Duration
 }
 
 // persistencePolicy policy
@@ -25,24 +50,60 @@ type persistenceOption struct {
 	enablePersistence bool        // enable persistencePolicy
 	persistencePolicy Persistence // persistencePolicy policy
 	persistencePath   string      // persistencePath
+	persistenceCodec  Codec       // serialization of the persisted data
+	walPath           string      // write-ahead log, empty means it is not enabled
+	createDirs        bool        // create the folders of the persistence file and the write-ahead log
+	persistErrors     chan error  // errors of the periodic backup, shared by the shards of a sharded cache
+}
+
+// eviction policy
+type evictionOption struct {
+	maxEntries int        // Maximum number of data, 0 means unlimited
+	maxBytes   int64      // Maximum total size of data, 0 means unlimited
+	sizer      any        // Approximate size of data, func(value E) int64
+	cost       any        // Cost of recomputing data, func(value E) int64
+	onEvicted  any        // Eviction callback, func(key K, value E, reason EvictionReason)
+	fullPolicy FullPolicy // What to do when data is set into a full cache
+	// Order in which data is evicted
+	evictionPolicy EvictionPolicy
 }
 
 type options struct {
 	expirationOption
 	persistenceOption
+	evictionOption
+	createOnIncrement bool // Increment and Decrement create the data if it does not exist
+	enableStats       bool // Collect statistics
+	enableEvents      bool // Send changes of the data to the events channel
+	eventBuffer       int  // Buffer of the events channel
+	eventChan         any  // Events channel shared by the shards, chan CacheEvent[K, E]
+	loader            any  // Load the data on a miss, func(key K) (E, time.Duration, error)
+	trackAccess       bool // Count the reads of each data
+	copier            any  // Copy the data on set and get, func(value E) E
+	initialCapacity   int  // Number of data the map is preallocated for
+	// The cache is closed when it is done, nil means the cache is only closed by Close
+	ctx context.Context
+	// Hash of the key that selects the shard of a sharded cache, nil means fnv-1a
+	shardHasher func(key string) uint64
+	dedupe      any // Equality of the data that makes Set a no-op, func(a, b E) bool
+	// Compress the data of a []byte cache with gzip
+	compressValues bool
 }
 
 func newOption() options {
 	return options{
-		expirationOption{
+		expirationOption: expirationOption{
 			expiration: DefaultExpiration,
 			gcInterval: DefaultInterval,
+			clock:      systemClock{},
 		},
-		persistenceOption{
+		persistenceOption: persistenceOption{
 			enablePersistence: false,
 			persistencePolicy: FFB,
 			persistencePath:   DefaultPersistencePath,
+			persistenceCodec:  GobCodec{},
 		},
+		evictionOption: evictionOption{evictionPolicy: LRU},
 	}
 }
 
@@ -59,12 +120,117 @@ func SetExpirationTime(expiration time.Duration) CreateOptionFunc {
 
 // SetGcInterval  set gc interval
 // When the cleaning cycle is 0, it is automatically adjusted to 1 minute
+// Unlike WithGcInterval, it does not start gc when the data never expires by default
 func SetGcInterval(gcInterval time.Duration) CreateOptionFunc {
 	if gcInterval == 0 {
 		gcInterval = time.Minute
 	}
 	return func(o *options) {
 		o.gcInterval = gcInterval
+		o.gcIntervalSet = true
+	}
+}
+
+// WithGcInterval  set gc interval, it must be greater than 0
+// GC is started automatically even if the default expiration time is DefaultExpiration,
+// so that data set with a ttl is cleaned up
+// If it is not set, the gc interval is the smaller of the expiration time and DefaultInterval
+func WithGcInterval(gcInterval time.Duration) CreateOptionFunc {
+	return func(o *options) {
+		o.gcInterval = gcInterval
+		o.gcIntervalSet = true
+		o.gcEnabled = true
+	}
+}
+
+// WithSlidingExpiration extend the expiration time of the data by the default expiration time on every Get
+// GC only removes data that has expired at the time of the scan, so data that keeps being read will never be removed
+// Data that never expires is not affected
+func WithSlidingExpiration() CreateOptionFunc {
+	return func(o *options) {
+		o.sliding = true
+	}
+}
+
+// WithExpirationJitter randomize the expiration time of each data within ±fraction of the default expiration time,
+// so that data set at the same time does not expire at the same time
+// It only applies to the default expiration time, data set with an explicit ttl is not affected
+// fraction must be in [0, 1), otherwise NewMapCache returns an error
+func WithExpirationJitter(fraction float64) CreateOptionFunc {
+	return func(o *options) {
+		o.jitter = fraction
+	}
+}
+
+// WithMaxTTL cap the time any data is cached at d, an expiration time later than d from now is silently capped at it
+// It applies to all writes including the default expiration time, SetWithTTL and SetExpireAt,
+// and data that would never expire expires after d, 0 means unlimited, a negative d makes NewMapCache return an error
+func WithMaxTTL(d time.Duration) CreateOptionFunc {
+	return func(o *options) {
+		o.maxTTL = d
+	}
+}
+
+// WithStaleWhileRevalidate keep expired data for grace after it expires, so that GetStale can still return it
+// while the caller refreshes it, GC only removes data that has expired for longer than grace
+// Other operations treat the data as expired as usual, grace must not be negative
+func WithStaleWhileRevalidate(grace time.Duration) CreateOptionFunc {
+	return func(o *options) {
+		o.staleGrace = grace
+	}
+}
+
+// WithClock set the source of the current time used to generate and check expiration times, default is the system clock
+// It is mainly used to step past expiration times in tests without sleeping, GC still runs at the real gc interval
+func WithClock(clock Clock) CreateOptionFunc {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithGcBatchSize make DeleteExpired release and reacquire the lock after every n data scanned
+// instead of holding it for the whole scan, so that reads and writes are not stalled by gc on a large cache
+// If n is 0, the whole map is scanned under the lock at once, a negative n makes NewMapCache return an error
+func WithGcBatchSize(n int) CreateOptionFunc {
+	return func(o *options) {
+		o.gcBatchSize = n
+	}
+}
+
+// WithGcSleep make DeleteExpired pause for d without holding the lock after every batch set by WithGcBatchSize,
+// so that gc on a large cache spreads its CPU usage over time instead of spiking, expired data is reclaimed later
+// It requires WithGcBatchSize, d must not be negative
+func WithGcSleep(d time.Duration) CreateOptionFunc {
+	return func(o *options) {
+		o.gcSleep = d
+	}
+}
+
+// WithAdaptiveGc make gc wake up when the next data expires instead of only at the gc interval,
+// so that data with a short ttl is removed soon after it expires even if the gc interval is long
+// The expiration times are kept in a heap updated on every set, so each set costs O(log n) more,
+// gc is started even if the data never expires by default, and still scans all data every gc interval
+func WithAdaptiveGc() CreateOptionFunc {
+	return func(o *options) {
+		o.adaptiveGc = true
+	}
+}
+
+// WithAutoGcIdempotent make StartGc do nothing and return nil when gc is running, instead of returning an error,
+// so that it is safe to call StartGc repeatedly without tracking whether gc is running
+func WithAutoGcIdempotent() CreateOptionFunc {
+	return func(o *options) {
+		o.idempotentGc = true
+	}
+}
+
+// WithLazyExpiration do not start gc automatically, so that the cache runs no background goroutine for expiration
+// Expired data is still treated as absent, and it is deleted when a read such as Get finds it,
+// expired data that is never read again stays in memory until it is overwritten or DeleteExpired is called
+// It can not be used with WithGcInterval or WithAdaptiveGc
+func WithLazyExpiration() CreateOptionFunc {
+	return func(o *options) {
+		o.lazy = true
 	}
 }
 
@@ -89,3 +255,307 @@ func SetPersistencePath(path string) CreateOptionFunc {
 		o.persistencePath = path
 	}
 }
+
+// WithWAL append every change of the data to the write-ahead log at path, and empty it after each snapshot
+// is written by the periodic backup, Flush or Close, so that changes between snapshots are not lost on a crash
+// On start the snapshot is loaded first and then the log is replayed, a partially written record at the end is dropped
+// The log is written with the persistence codec and requires SetEnablePersistence,
+// each shard of a ShardedMapCache appends the shard index to path
+// The expiration time extended by WithSlidingExpiration is not logged, it is saved by the next snapshot
+func WithWAL(path string) CreateOptionFunc {
+	return func(o *options) {
+		o.walPath = path
+	}
+}
+
+// WithCreateDirs create the folders of the persistence file and the write-ahead log if they do not exist
+// Without it, NewMapCache returns an error if a folder does not exist
+func WithCreateDirs() CreateOptionFunc {
+	return func(o *options) {
+		o.createDirs = true
+	}
+}
+
+// WithMaxEntries set the maximum number of data
+// When the cache is full, the least recently used data will be evicted on the next Set/Add
+// If n is 0, the number of data is unlimited, a negative n makes NewMapCache return an error
+func WithMaxEntries(n int) CreateOptionFunc {
+	return func(o *options) {
+		o.maxEntries = n
+	}
+}
+
+// WithOnEvicted set the callback called when data leaves the cache
+// It is called after the lock is released, so it can access the cache again
+// The types of key and value must be the same as the cache, otherwise NewMapCache returns an error
+func WithOnEvicted[K comparable, E any](fn func(key K, value E, reason EvictionReason)) CreateOptionFunc {
+	return func(o *options) {
+		o.onEvicted = fn
+	}
+}
+
+// WithCreateOnIncrement Increment and Decrement of NumberMapCache create the data if it does not exist
+// instead of returning an error
+func WithCreateOnIncrement() CreateOptionFunc {
+	return func(o *options) {
+		o.createOnIncrement = true
+	}
+}
+
+// WithStats enable statistics of hits, misses, sets, evictions and deletes, see Stats
+func WithStats() CreateOptionFunc {
+	return func(o *options) {
+		o.enableStats = true
+	}
+}
+
+// WithPersistenceCodec set the serialization of the persisted data, default codec is GobCodec
+func WithPersistenceCodec(codec Codec) CreateOptionFunc {
+	return func(o *options) {
+		o.persistenceCodec = codec
+	}
+}
+
+// check the assembled options, NewMapCache returns the error if options conflict
+func (o *options) validate() error {
+	if o.expiration <= 0 && o.expiration != DefaultExpiration {
+		return fmt.Errorf("the expiration time %v must be greater than 0 or DefaultExpiration", o.expiration)
+	}
+	if o.gcInterval <= 0 {
+		return fmt.Errorf("the gc interval %v must be greater than 0", o.gcInterval)
+	}
+	if o.clock == nil {
+		return errors.New("the clock must not be nil")
+	}
+	if o.jitter < 0 || o.jitter >= 1 {
+		return fmt.Errorf("the expiration jitter %v must be in [0, 1)", o.jitter)
+	}
+	if o.maxTTL < 0 {
+		return fmt.Errorf("the maximum ttl %v must not be negative", o.maxTTL)
+	}
+	if o.refreshAhead < 0 {
+		return fmt.Errorf("the refresh ahead window %v must not be negative", o.refreshAhead)
+	}
+	if o.refreshAhead > 0 && o.loader == nil {
+		return errors.New("refresh ahead requires a loader set by WithLoader")
+	}
+	if o.serveStale && o.loader == nil {
+		return errors.New("serving stale data on error requires a loader set by WithLoader")
+	}
+	if o.lazy && (o.gcEnabled || o.adaptiveGc) {
+		return errors.New("lazy expiration can not be used with the gc interval or the adaptive gc")
+	}
+	if o.gcBatchSize < 0 {
+		return fmt.Errorf("the gc batch size %d must not be negative", o.gcBatchSize)
+	}
+	if o.gcSleep < 0 {
+		return fmt.Errorf("the gc sleep %v must not be negative", o.gcSleep)
+	}
+	if o.gcSleep > 0 && o.gcBatchSize == 0 {
+		return errors.New("the gc sleep requires a gc batch size set by WithGcBatchSize")
+	}
+	if o.staleGrace < 0 {
+		return fmt.Errorf("the stale grace %v must not be negative", o.staleGrace)
+	}
+	if o.staleErrorGrace < 0 {
+		return fmt.Errorf("the grace of serving stale data on error %v must not be negative", o.staleErrorGrace)
+	}
+	if o.enableEvents && o.eventBuffer <= 0 {
+		return fmt.Errorf("the event buffer %d must be greater than 0", o.eventBuffer)
+	}
+	if o.maxEntries < 0 {
+		return fmt.Errorf("the maximum number of data %d must not be negative", o.maxEntries)
+	}
+	if o.maxBytes < 0 {
+		return fmt.Errorf("the maximum size of data %d must not be negative", o.maxBytes)
+	}
+	if o.fullPolicy != EvictLRU && o.fullPolicy != RejectNew {
+		return fmt.Errorf("unknown full policy %d", o.fullPolicy)
+	}
+	if o.evictionPolicy == nil {
+		return errors.New("the eviction policy must not be nil")
+	}
+	if _, ok := o.evictionPolicy.(orderedPolicy); !ok && o.cost != nil {
+		return errors.New("the cost function can not be used with a custom eviction policy")
+	}
+	if o.initialCapacity < 0 {
+		return fmt.Errorf("the initial capacity %d must not be negative", o.initialCapacity)
+	}
+	if o.enablePersistence {
+		if o.persistenceName == "" {
+			return errors.New("the persistence name must not be empty when persistence is enabled")
+		}
+		if o.persistencePath == "" {
+			return errors.New("the persistence path must not be empty when persistence is enabled")
+		}
+		if o.persistenceCodec == nil {
+			return errors.New("the persistence codec must not be nil when persistence is enabled")
+		}
+	} else if o.walPath != "" {
+		return errors.New("the write-ahead log requires persistence to be enabled")
+	}
+	return nil
+}
+
+// WithMaxBytes set the maximum total size of data
+// When the cache is over the limit, the least recently used data will be evicted on the next Set/Add
+// The size of data is calculated by the sizer set by WithSizer, without a sizer each data counts as 1
+// If n is 0, the size of data is unlimited, a negative n makes NewMapCache return an error
+func WithMaxBytes(n int64) CreateOptionFunc {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// WithSizer set the function that calculates the approximate size of data, used by WithMaxBytes
+// The type of value must be the same as the data type of the cache, otherwise NewMapCache returns an error
+func WithSizer[E any](sizer func(value E) int64) CreateOptionFunc {
+	return func(o *options) {
+		o.sizer = sizer
+	}
+}
+
+// WithCost set the function that calculates the cost of recomputing data
+// When the cache is over the limit set by WithMaxEntries or WithMaxBytes, the data with the lowest cost is evicted first,
+// and the least recently used one among the data with the same cost, so expensive data is kept longer
+// Finding the data to evict scans all data, so eviction is O(n) with a cost function
+// The type of value must be the same as the data type of the cache, otherwise NewMapCache returns an error
+func WithCost[E any](cost func(value E) int64) CreateOptionFunc {
+	return func(o *options) {
+		o.cost = cost
+	}
+}
+
+// WithEvents send changes of the data to the channel returned by Events, buffer is the size of the channel
+// and must be greater than 0. Sending never blocks the cache, events are dropped and counted by DroppedEvents
+// when the channel is full, so the consumer should keep reading it
+func WithEvents(buffer int) CreateOptionFunc {
+	return func(o *options) {
+		o.enableEvents = true
+		o.eventBuffer = buffer
+	}
+}
+
+// WithLoader set the function that loads the data on a miss, so that the cache reads through to the backing store
+// Get and GetLoad call loader when the data does not exist or expires, and set the loaded data with the returned ttl,
+// a ttl of 0 means the default expiration time, and a negative ttl means never expire
+// Concurrent misses for the same key share a single load, and nothing is set if loader returns an error
+// The types of key and value must be the same as the cache, otherwise NewMapCache returns an error
+func WithLoader[K comparable, E any](loader func(key K) (E, time.Duration, error)) CreateOptionFunc {
+	return func(o *options) {
+		o.loader = loader
+	}
+}
+
+// WithRefreshAhead reload the data with the loader set by WithLoader in the background when Get or GetLoad
+// finds data that expires within window, the current data is still returned immediately
+// Concurrent refreshes of the same key share a single load, the data is kept if the loader returns an error
+// window must not be negative, and NewMapCache returns an error if no loader is set
+func WithRefreshAhead(window time.Duration) CreateOptionFunc {
+	return func(o *options) {
+		o.refreshAhead = window
+	}
+}
+
+// WithServeStaleOnError keep expired data for grace after it expires, and return it from Get, GetLoad and the other
+// reads that load the data when the loader set by WithLoader returns an error, so that a failing backend does not
+// make the data disappear. After a failure the loader of the key is retried with a backoff that starts at 1s and
+// doubles up to 1m, the expired data is returned without calling the loader until then
+// The error is still returned when there is no expired data within grace. It is independent of the grace of
+// WithStaleWhileRevalidate, GetStale still uses that grace, and expired data is kept for the longer of the two
+// grace must not be negative, and NewMapCache returns an error if no loader is set
+func WithServeStaleOnError(grace time.Duration) CreateOptionFunc {
+	return func(o *options) {
+		o.staleErrorGrace = grace
+		o.serveStale = true
+	}
+}
+
+// WithAccessTracking count the reads of each data that find live data, see TopKeys and BottomKeys
+// The count is kept while the data is overwritten, and is dropped when the data leaves the cache
+func WithAccessTracking() CreateOptionFunc {
+	return func(o *options) {
+		o.trackAccess = true
+	}
+}
+
+// WithCopier set the function that deep copies the data, so that the cache has value semantics
+// The data is copied when it is set and when it is returned by Get and the other reads, changing the data
+// after Set or changing the result of Get does not affect the cache. Without it, the data is shared by reference
+// Every set and every read allocates a copy, so it costs as much as copier, use it only for mutable data such as slices and maps
+// The type of value must be the same as the data type of the cache, otherwise NewMapCache returns an error
+func WithCopier[E any](copier func(value E) E) CreateOptionFunc {
+	return func(o *options) {
+		o.copier = copier
+	}
+}
+
+// WithDedupe set the equality of the data, so that setting data equal to the data that exists does nothing:
+// the expiration time is not reset and no event is sent. It applies to Set, SetDefault, SetWithTTL, SetExpireAt,
+// SetReport, SetMany and SetManyWithTTL, other writes such as Replace and GetAndSet always set the data
+// The type of eq must match the data type of the cache, otherwise NewMapCache returns an error
+func WithDedupe[E any](eq func(a, b E) bool) CreateOptionFunc {
+	return func(o *options) {
+		o.dedupe = eq
+	}
+}
+
+// WithValueCompression compress the data of a cache of []byte with gzip when it is set, and decompress it when it is read,
+// so that large compressible data such as json or text takes less memory. Reads return the original data
+// The sizer and the cost function, ApproxBytes, the persistence file, the write-ahead log, MarshalJSON and the cold tier
+// of a TieredCache see the compressed data. Every set and every read compresses or decompresses the data,
+// so it costs cpu time and is not worth it for small data. The data is not shared with the caller, so WithCopier is not needed
+// The data type of the cache must be []byte, otherwise NewMapCache returns an error
+func WithValueCompression() CreateOptionFunc {
+	return func(o *options) {
+		o.compressValues = true
+	}
+}
+
+// WithInitialCapacity preallocate the map for n data, so that loading a known number of data does not rehash the map
+// repeatedly as it grows. It is only a hint, the cache still grows beyond n. n must not be negative
+func WithInitialCapacity(n int) CreateOptionFunc {
+	return func(o *options) {
+		o.initialCapacity = n
+	}
+}
+
+// WithContext close the cache when ctx is done, so that the lifecycle of the cache follows ctx
+// It is the same as calling Close: gc and persistence stop, the data is persisted one last time if persistence is enabled,
+// and gc can not be started again
+func WithContext(ctx context.Context) CreateOptionFunc {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithFullPolicy set what to do when data is set into a cache that is full, it only takes effect with
+// WithMaxEntries or WithMaxBytes. The default EvictLRU evicts data to make room, RejectNew keeps the data in the cache
+// and rejects the new data instead: Set and SetMany drop it, Add, AddWithTTL and Replace return ErrCacheFull,
+// and SetIfAbsent returns false. Expired data that has not been cleaned up still takes room
+func WithFullPolicy(policy FullPolicy) CreateOptionFunc {
+	return func(o *options) {
+		o.fullPolicy = policy
+	}
+}
+
+// WithEvictionPolicy set the order in which data is evicted when the cache is full, it only takes effect with
+// WithMaxEntries or WithMaxBytes. The default LRU evicts the least recently used data, FIFO evicts the data inserted
+// first and does not reorder the data on reads, so reads do less work
+// LRU, FIFO and the other LRUPolicy and FIFOPolicy values give each cache its own empty policy. Other policies,
+// including ones that wrap an LRUPolicy, keep the state of one cache, so they can not be used by NewShardedMapCache
+// with more than one shard or with WithCost, and the clone of the cache evicts in LRU order
+func WithEvictionPolicy(policy EvictionPolicy) CreateOptionFunc {
+	return func(o *options) {
+		o.evictionPolicy = policy
+	}
+}
+
+// WithShardHasher set the hash of the key that selects the shard of the cache created by NewShardedMapCache,
+// the default is fnv-1a. Use it to tune the distribution, or to put related keys in the same shard
+// so that they share one lock. The other caches ignore it
+func WithShardHasher(hasher func(key string) uint64) CreateOptionFunc {
+	return func(o *options) {
+		o.shardHasher = hasher
+	}
+}
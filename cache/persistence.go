@@ -1,8 +1,10 @@
 package cache
 
 import (
-	"encoding/gob"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -10,6 +12,15 @@ import (
 
 const FileSUFFIX = "_ffb.cdb"
 
+const (
+	// number of errors of the periodic backup and the write-ahead log kept until they are read, see PersistErrors
+	persistErrorBuffer = 16
+	// suffix of the backup of the persistence file
+	backupSuffix = ".bak"
+	// pattern of the temporary file that is renamed to the persistence file
+	tempSuffix = ".tmp*"
+)
+
 // Persistence  policy
 type Persistence int
 
@@ -20,80 +31,374 @@ const (
 	//AOF
 )
 
-func (persistence *persistenceOption) startPersistence(data interface{}) error {
-	switch persistence.persistencePolicy {
+// start persistence, load the data from the file and back up the data periodically
+func (c *mapCache[K, E]) startPersistence() error {
+	switch c.persistencePolicy {
 	case FFB:
-		err := persistence.read(data)
+		err := checkWritable(c.file(), c.createDirs)
+		if err != nil {
+			return err
+		}
+		items, err := c.read()
 		if err != nil {
 			return err
 		}
-		go persistence.backup(data)
+		c.items = items
+		if c.walPath != "" {
+			err = checkWritable(c.walPath, c.createDirs)
+			if err != nil {
+				return err
+			}
+			err = c.openWal()
+			if err != nil {
+				return err
+			}
+		}
+		c.dropExpired()
+		if c.persistErrors == nil {
+			c.persistErrors = make(chan error, persistErrorBuffer)
+		}
+		c.stopPersistence = make(chan struct{})
+		c.persistenceDone = make(chan struct{})
+		go c.backup(c.stopPersistence, c.persistenceDone)
 	}
 	return nil
 }
 
-// load file
-func (persistence *persistenceOption) read(data interface{}) error {
-	file := filepath.Join(persistence.persistencePath, fmt.Sprintf("%s%s", persistence.persistenceName, FileSUFFIX))
-	_, err := os.Stat(file)
-	// Skip this step if the file exists
-	if err != nil {
+// stop the backup goroutine and back up the data one last time
+// It waits for the backup in progress to finish, and the last backup waits for any running Flush
+func (c *mapCache[K, E]) closePersistence() error {
+	if c.stopPersistence == nil {
 		return nil
 	}
-	fileData, err := os.OpenFile(file, os.O_RDWR, os.ModePerm)
-	if err != nil {
-		return err
-	}
-	decoder := gob.NewDecoder(fileData)
-	err = decoder.Decode(data)
-	if err != nil {
-		return err
+	close(c.stopPersistence)
+	<-c.persistenceDone
+	c.stopPersistence = nil
+	err := c.persist()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.closeWal(); err == nil {
+		err = e
 	}
-	return nil
+	return err
 }
 
 // If an error occurs, it fails the backup
-// If the main process ends, it fails the backup and the file are 0 bytes
-func (persistence *persistenceOption) backup(data interface{}) {
-	file := filepath.Join(persistence.persistencePath, fmt.Sprintf("%s%s", persistence.persistenceName, FileSUFFIX))
+func (c *mapCache[K, E]) backup(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
 	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			err := judgeAndCreate(file)
+			err := c.persist()
 			if err != nil {
-				continue
+				c.reportPersistError(err)
 			}
-			func() {
-				f, err := os.OpenFile(file, os.O_RDWR, os.ModePerm)
-				if err != nil {
-					return
-				}
-				defer f.Close()
-				encoder := gob.NewEncoder(f)
-				err = encoder.Encode(data)
-				if err != nil {
-					fmt.Println(err)
-					return
-				}
-			}()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// send an error of the periodic backup or the write-ahead log without blocking,
+// the oldest error is dropped if the channel is full
+func (c *mapCache[K, E]) reportPersistError(err error) {
+	if c.persistErrors == nil {
+		return
+	}
+	for {
+		select {
+		case c.persistErrors <- err:
+			return
+		default:
+		}
+		select {
+		case <-c.persistErrors:
+		default:
+		}
+	}
+}
+
+// PersistErrors get the channel of the errors of the periodic backup and of appending to the write-ahead log,
+// so that failed backups and changes missing from the log can be observed
+// The channel keeps the latest 16 errors, older errors are dropped when it is full. It returns nil if persistence
+// is not enabled, the channel is never closed. Errors of Flush and Close are returned by them instead
+func (c *mapCache[K, E]) PersistErrors() <-chan error {
+	return c.persistErrors
+}
+
+// write the data to the file under the read lock, and empty the write-ahead log
+// Expired data that has not been cleaned up is skipped, so that it is not loaded again
+func (c *mapCache[K, E]) persist() error {
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	err := c.write(c.liveItems())
+	if err != nil {
+		return err
+	}
+	return c.truncateWal()
+}
+
+// CompactAndFlush delete all expired data and write the rest to the persistence file under one write lock,
+// so that no data can be set in between and the file only holds the data that is not expired
+// It returns an error if persistence is not enabled or the cache is closed
+func (c *mapCache[K, E]) CompactAndFlush() error {
+	if !c.enablePersistence {
+		return errors.New("persistence is not enabled")
+	}
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+	c.mu.Lock()
+	defer c.unlock()
+	if c.closed {
+		return errors.New("the cache is closed")
+	}
+	now := c.now()
+	for k, v := range c.items {
+		if v.expiredFor(now, c.keepExpired()) {
+			c.del(k, ReasonExpired)
+		}
+	}
+	c.deleteExpiredMisses()
+	err := c.write(c.liveItems())
+	if err != nil {
+		return err
+	}
+	return c.truncateWal()
+}
+
+// Flush write the data to the persistence file immediately instead of waiting for the next backup
+// Expired data that has not been cleaned up is skipped,
+// it returns an error if persistence is not enabled or the cache is closed
+func (c *mapCache[K, E]) Flush() error {
+	if !c.enablePersistence {
+		return errors.New("persistence is not enabled")
+	}
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return errors.New("the cache is closed")
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	err := c.write(c.liveItems())
+	if err != nil {
+		return err
+	}
+	return c.truncateWal()
+}
+
+// Save write a snapshot of the data to w with the persistence codec
+// Expired data that has not been cleaned up is skipped
+func (c *mapCache[K, E]) Save(w io.Writer) error {
+	data, err := c.persistenceCodec.Marshal(c.snapshot())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Load read a snapshot of the data from r with the persistence codec, and set the data
+// It overwrites the data if the key exists, expired data in the snapshot is skipped
+func (c *mapCache[K, E]) Load(r io.Reader) error {
+	items, err := decodeSnapshot[K, E](r, c.persistenceCodec)
+	if err != nil {
+		return err
+	}
+	c.restore(items)
+	return nil
+}
+
+// MarshalJSON serialize the data that is not expired with their expiration times under the read lock,
+// so that the cache can be dumped with json.Marshal
+func (c *mapCache[K, E]) MarshalJSON() ([]byte, error) {
+	return JSONCodec{}.Marshal(c.snapshot())
+}
+
+// UnmarshalJSON set the data serialized by MarshalJSON, so that a cache can be filled with json.Unmarshal
+// It overwrites the data if the key exists, expired data is skipped
+func (c *mapCache[K, E]) UnmarshalJSON(data []byte) error {
+	items, err := decodeSnapshot[K, E](bytes.NewReader(data), JSONCodec{})
+	if err != nil {
+		return err
+	}
+	c.restore(items)
+	return nil
+}
+
+// copy the data that is not expired under the read lock
+func (c *mapCache[K, E]) snapshot() map[K]*Item[E] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.liveItems()
+}
+
+// copy the data that is not expired
+func (c *mapCache[K, E]) liveItems() map[K]*Item[E] {
+	res := make(map[K]*Item[E], len(c.items))
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) {
+			res[k] = &Item[E]{Object: v.Object, Expiration: v.Expiration}
+		}
+	}
+	return res
+}
+
+// remove the data that has expired while the cache was not running, it is called after loading the file
+func (c *mapCache[K, E]) dropExpired() {
+	now := c.now()
+	for k, v := range c.items {
+		if v == nil || v.expired(now) {
+			delete(c.items, k)
 		}
 	}
 }
 
-//Judge whether a file or folder exists. If it does not exist, create it
-func judgeAndCreate(path string) error {
-	_, err := os.Stat(path)
+// set the data that is not expired
+func (c *mapCache[K, E]) restore(items map[K]*Item[E]) {
+	c.mu.Lock()
+	defer c.unlock()
+	now := c.now()
+	for k, v := range items {
+		if v != nil && !v.expired(now) {
+			c.store(k, c.repack(v.Object), v.Expiration)
+		}
+	}
+}
+
+// read and decode a snapshot
+func decodeSnapshot[K comparable, E any](r io.Reader, codec Codec) (map[K]*Item[E], error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[K]*Item[E])
+	err = codec.Unmarshal(data, &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// get the persistence file
+func (persistence *persistenceOption) file() string {
+	return filepath.Join(persistence.persistencePath, fmt.Sprintf("%s%s", persistence.persistenceName, FileSUFFIX))
+}
+
+// get the backup of the persistence file, it holds the previous snapshot
+func (persistence *persistenceOption) backupFile() string {
+	return persistence.file() + backupSuffix
+}
+
+// load the data from the file
+// If the file does not exist or is corrupt, for example the process crashed while replacing it,
+// the previous snapshot in the backup file is loaded instead
+func (c *mapCache[K, E]) read() (map[K]*Item[E], error) {
+	items, err := c.readFile(c.file())
 	if err == nil {
-		return nil
+		return items, nil
+	}
+	if items, backupErr := c.readFile(c.backupFile()); backupErr == nil {
+		return items, nil
 	}
-	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if os.IsNotExist(err) {
+		// Skip this step if neither file exists
+		return make(map[K]*Item[E]), nil
+	}
+	return nil, err
+}
+
+// load and decode a file, an empty file is skipped
+func (c *mapCache[K, E]) readFile(file string) (map[K]*Item[E], error) {
+	fileData, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// Skip this step if the file is empty
+	if len(fileData) == 0 {
+		return make(map[K]*Item[E]), nil
+	}
+	return decodeSnapshot[K, E](bytes.NewReader(fileData), c.persistenceCodec)
+}
+
+// write file
+// The data is written to a temporary file in the same folder and synced to disk first,
+// then the current file is kept as the backup and the temporary file is renamed into place,
+// so a crash in the middle of writing never leaves a partially written file behind
+func (persistence *persistenceOption) write(data interface{}) error {
+	fileData, err := persistence.persistenceCodec.Marshal(data)
 	if err != nil {
 		return err
 	}
-	_, err = os.Create(path)
+	file := persistence.file()
+	tmp, err := writeTemp(file, fileData)
 	if err != nil {
 		return err
 	}
+	err = os.Rename(file, persistence.backupFile())
+	if err != nil && !os.IsNotExist(err) {
+		_ = os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, file)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
 	return nil
 }
+
+// check that file is not a folder and its folder is writable, so that a path that can not be written
+// is reported when the cache is created instead of failing every backup. The folder is created if createDirs is true
+func checkWritable(file string, createDirs bool) error {
+	dir := filepath.Dir(file)
+	if createDirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("can not create the persistence folder %s: %w", dir, err)
+		}
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("the persistence folder %s can not be accessed: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("the persistence folder %s is not a folder", dir)
+	}
+	if info, err = os.Stat(file); err == nil && info.IsDir() {
+		return fmt.Errorf("the persistence file %s is a folder", file)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(file)+tempSuffix)
+	if err != nil {
+		return fmt.Errorf("the persistence folder %s is not writable: %w", dir, err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// write data to a temporary file next to file and sync it, it returns the name of the temporary file
+func writeTemp(file string, data []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+tempSuffix)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,111 @@
+package cache
+
+import "container/list"
+
+// EvictionPolicy the order in which data is evicted when the cache is full, see WithEvictionPolicy
+// LRU and FIFO are built in, implement it to plug in other policies such as ARC or 2Q
+// The cache calls it under its write lock, so it does not need to be safe for concurrent use, and it must not
+// call the cache. The keys are the keys of the cache, a string for MapCache
+type EvictionPolicy interface {
+	// RecordInsert record that data is set by a key that is not in the cache
+	RecordInsert(key any)
+	// RecordAccess record that data is read or overwritten
+	RecordAccess(key any)
+	// RecordRemove record that data leaves the cache, including the data chosen by Evict
+	RecordRemove(key any)
+	// Evict choose the data to evict, the cache deletes it and calls RecordRemove
+	// It returns false if there is no data to evict
+	Evict() (key any, ok bool)
+	// Reset forget all keys, it is called by Clear
+	Reset()
+}
+
+// a policy that gives each cache its own instance, so that one value can be set on many caches, such as the shards
+type policyTemplate interface {
+	newPolicy() EvictionPolicy
+}
+
+// a policy that can list the keys in the order of eviction, so that the cost function can be used with it
+type orderedPolicy interface {
+	// call fn with the keys from the next one to evict, until fn returns false
+	each(fn func(key any) bool)
+}
+
+var (
+	// LRU evict the least recently used data, reads and overwrites move the data to the front
+	LRU EvictionPolicy = &LRUPolicy{}
+	// FIFO evict the data inserted first, reads and overwrites do not change the order, so reads are cheaper
+	FIFO EvictionPolicy = &FIFOPolicy{}
+)
+
+// LRUPolicy evict the least recently used data, the zero value is ready to use
+// Each cache it is set on gets its own empty LRUPolicy, so the value set by WithEvictionPolicy is never changed,
+// use a new LRUPolicy to wrap it in another policy
+type LRUPolicy struct {
+	keys     *list.List // from the most recently used to the least recently used key
+	elements map[any]*list.Element
+}
+
+func (p *LRUPolicy) newPolicy() EvictionPolicy {
+	return &LRUPolicy{}
+}
+
+func (p *LRUPolicy) RecordInsert(key any) {
+	if p.keys == nil {
+		p.Reset()
+	}
+	if e, ok := p.elements[key]; ok {
+		p.keys.MoveToFront(e)
+		return
+	}
+	p.elements[key] = p.keys.PushFront(key)
+}
+
+func (p *LRUPolicy) RecordAccess(key any) {
+	if e, ok := p.elements[key]; ok {
+		p.keys.MoveToFront(e)
+	}
+}
+
+func (p *LRUPolicy) RecordRemove(key any) {
+	if e, ok := p.elements[key]; ok {
+		p.keys.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *LRUPolicy) Evict() (any, bool) {
+	if p.keys == nil || p.keys.Len() == 0 {
+		return nil, false
+	}
+	return p.keys.Back().Value, true
+}
+
+func (p *LRUPolicy) Reset() {
+	p.keys = list.New()
+	p.elements = make(map[any]*list.Element)
+}
+
+func (p *LRUPolicy) each(fn func(key any) bool) {
+	if p.keys == nil {
+		return
+	}
+	for e := p.keys.Back(); e != nil; e = e.Prev() {
+		if !fn(e.Value) {
+			return
+		}
+	}
+}
+
+// FIFOPolicy evict the data inserted first, the zero value is ready to use
+// Like LRUPolicy, each cache it is set on gets its own empty FIFOPolicy
+type FIFOPolicy struct {
+	LRUPolicy
+}
+
+func (p *FIFOPolicy) newPolicy() EvictionPolicy {
+	return &FIFOPolicy{}
+}
+
+// RecordAccess do nothing, reads and overwrites do not change the order
+func (p *FIFOPolicy) RecordAccess(any) {}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operations that are only available for string keys
+
+// DeleteByPrefix delete all data whose key starts with prefix, and return the number of data deleted
+// Expired data that matches is also removed but not counted
+// An empty prefix matches all data, it scans all data, so it is O(n)
+func (c *MapCache[E]) DeleteByPrefix(prefix string) int {
+	return deleteByPrefix(c.mapCache, prefix)
+}
+
+// KeysWithPrefix get all keys that start with prefix
+// Expired data that has not been cleaned up is skipped, an empty prefix matches all data, it scans all data, so it is O(n)
+func (c *MapCache[E]) KeysWithPrefix(prefix string) []string {
+	return keysWithPrefix(c.mapCache, prefix)
+}
+
+// FromMap set all data in m with the same ttl under one lock, in the order of the sorted keys,
+// so that the insertion order, and so the eviction order with the FIFO policy, is deterministic
+// It overwrites the data if the key exists. A ttl of 0 means the default expiration time, and a negative ttl means never expire
+func (c *MapCache[E]) FromMap(m map[string]E, ttl time.Duration) {
+	fromMap(c.mapCache, sortedKeys(m), m, ttl)
+}
+
+func deleteByPrefix[E any](c *mapCache[string, E], prefix string) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := 0
+	now := c.now()
+	for k, v := range c.items {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if v.expired(now) {
+			c.del(k, ReasonExpired)
+			continue
+		}
+		c.del(k, ReasonDeleted)
+		count++
+	}
+	return count
+}
+
+func keysWithPrefix[E any](c *mapCache[string, E], prefix string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make([]string, 0)
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) && strings.HasPrefix(k, prefix) {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// set the data of keys in m in the order of keys
+func fromMap[E any](c *mapCache[string, E], keys []string, m map[string]E, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+	for _, k := range keys {
+		c.set(k, m[k], c.generateExpirationWithTTL(ttl))
+	}
+}
+
+// get the keys of m in ascending order
+func sortedKeys[E any](m map[string]E) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package cache
+
+import "time"
+
+// ReadOnly get a read-only view of the cache, it shares the data with the cache
+// The view can not be converted back to the cache by a type assertion, so the consumer can not change the data
+func (c *MapCache[E]) ReadOnly() ReadOnlyMap[E] {
+	return readOnlyMap[E]{c}
+}
+
+// ReadOnly get a read-only view of the cache, it shares the data with the cache
+func (c *ShardedMapCache[E]) ReadOnly() ReadOnlyMap[E] {
+	return readOnlyMap[E]{c}
+}
+
+// readOnlyMap hide the write operations of the cache
+type readOnlyMap[E any] struct {
+	c MapInterface[E]
+}
+
+func (r readOnlyMap[E]) Get(key string) (E, bool) {
+	return r.c.Get(key)
+}
+
+func (r readOnlyMap[E]) GetWithExpiration(key string) (E, time.Time, bool) {
+	return r.c.GetWithExpiration(key)
+}
+
+func (r readOnlyMap[E]) TTL(key string) (time.Duration, bool) {
+	return r.c.TTL(key)
+}
+
+func (r readOnlyMap[E]) Len() int {
+	return r.c.Len()
+}
+
+func (r readOnlyMap[E]) Keys() []string {
+	return r.c.Keys()
+}
+
+func (r readOnlyMap[E]) Range(fn func(key string, value E) bool) {
+	r.c.Range(fn)
+}
@@ -0,0 +1,39 @@
+package cache
+
+import "sync"
+
+// an in-flight or completed computation, done is closed after value and err are set
+type call[E any] struct {
+	done  chan struct{}
+	value E
+	err   error
+}
+
+// flightGroup makes concurrent computations for the same key share a single execution
+type flightGroup[K comparable, E any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[E]
+}
+
+// do start fn in a new goroutine unless a computation for key is already in flight,
+// the caller waits on the done channel of the returned call
+func (g *flightGroup[K, E]) do(key K, fn func() (E, error)) *call[E] {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.calls[key]; ok {
+		return c
+	}
+	if g.calls == nil {
+		g.calls = make(map[K]*call[E])
+	}
+	c := &call[E]{done: make(chan struct{})}
+	g.calls[key] = c
+	go func() {
+		c.value, c.err = fn()
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	return c
+}
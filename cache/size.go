@@ -0,0 +1,48 @@
+package cache
+
+import "reflect"
+
+// ApproxBytes get the approximate total size of the data, including expired data that has not been cleaned up
+// With WithSizer it is the total calculated by the sizer, otherwise it is estimated from the type of the data:
+// strings and byte slices count their length, types of fixed size such as numbers and structs without pointers
+// count their memory size, and it returns -1 for other types. Without a sizer it scans all data, so it is O(n)
+func (c *mapCache[K, E]) ApproxBytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.sizer != nil {
+		return c.bytes
+	}
+	var zero E
+	t := reflect.TypeOf(&zero).Elem()
+	switch {
+	case t.Kind() == reflect.String, t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		var res int64
+		for _, v := range c.items {
+			res += int64(reflect.ValueOf(&v.Object).Elem().Len())
+		}
+		return res
+	case fixedSize(t):
+		return int64(t.Size()) * int64(len(c.items))
+	}
+	return -1
+}
+
+// judge whether the values of t have a fixed size and hold no pointers
+func fixedSize(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return fixedSize(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !fixedSize(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
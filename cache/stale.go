@@ -0,0 +1,97 @@
+package cache
+
+import "time"
+
+// backoff of the loader of a key after it fails, it doubles on every failure in a row, see WithServeStaleOnError
+const (
+	minStaleRetry = time.Second
+	maxStaleRetry = time.Minute
+)
+
+// loadFailure the failures in a row of the loader of a key
+type loadFailure struct {
+	failures int
+	retryAt  int64 // the loader is not called before this time, in microseconds
+}
+
+// get the time expired data is kept before it is removed, the longer of the graces of
+// WithStaleWhileRevalidate and WithServeStaleOnError
+func (c *mapCache[K, E]) keepExpired() time.Duration {
+	if c.staleErrorGrace > c.staleGrace {
+		return c.staleErrorGrace
+	}
+	return c.staleGrace
+}
+
+// get the expired data within the grace of WithServeStaleOnError, the caller must hold the write lock
+func (c *mapCache[K, E]) staleItem(key K) (*Item[E], bool) {
+	item, ok := c.items[key]
+	if !ok || item.expiredFor(c.now(), c.staleErrorGrace) {
+		return nil, false
+	}
+	return item, true
+}
+
+// get the expired data instead of calling the loader while the loader of the key backs off after a failure
+func (c *mapCache[K, E]) staleBackoff(key K) (E, bool) {
+	var zero E
+	if !c.serveStale {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	failure, ok := c.loadFailures[key]
+	if !ok || c.now() >= failure.retryAt {
+		return zero, false
+	}
+	item, ok := c.staleItem(key)
+	if !ok {
+		delete(c.loadFailures, key)
+		return zero, false
+	}
+	return c.unpack(item.Object), true
+}
+
+// record a failure of the loader, and get the expired data to return instead of the error
+// Nothing is recorded if there is no expired data, so that the next read calls the loader again
+func (c *mapCache[K, E]) staleOnError(key K) (E, bool) {
+	var zero E
+	if !c.serveStale {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	item, ok := c.staleItem(key)
+	if !ok {
+		delete(c.loadFailures, key)
+		return zero, false
+	}
+	if c.loadFailures == nil {
+		c.loadFailures = make(map[K]*loadFailure)
+	}
+	failure, ok := c.loadFailures[key]
+	if !ok {
+		failure = &loadFailure{}
+		c.loadFailures[key] = failure
+	}
+	failure.failures++
+	backoff := minStaleRetry
+	for i := 1; i < failure.failures && backoff < maxStaleRetry; i++ {
+		backoff *= 2
+	}
+	if backoff > maxStaleRetry {
+		backoff = maxStaleRetry
+	}
+	failure.retryAt = c.now() + backoff.Microseconds()
+	return c.unpack(item.Object), true
+}
+
+// forget the failures of the loader of the key after it succeeds
+func (c *mapCache[K, E]) loadSucceeded(key K) {
+	if !c.serveStale {
+		return
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	delete(c.loadFailures, key)
+}
@@ -0,0 +1,75 @@
+package cache
+
+import "sync/atomic"
+
+// CacheStats statistics of the cache
+type CacheStats struct {
+	Hits      int64 // number of reads that found live data
+	Misses    int64 // number of reads that found no data or expired data
+	Sets      int64 // number of data written
+	Evictions int64 // number of data removed because it expired or the cache is full
+	Deletes   int64 // number of data removed explicitly, including Clear
+	Entries   int   // number of data, including expired data that has not been cleaned up
+	Bytes     int64 // approximate size of data calculated by the sizer, each data counts as 1 if no sizer is set
+}
+
+// counters of the cache, updated with atomic operations
+type cacheStats struct {
+	hits      int64
+	misses    int64
+	sets      int64
+	evictions int64
+	deletes   int64
+}
+
+// The record methods do nothing if statistics are not enabled
+
+func (s *cacheStats) recordGet(hit bool) {
+	if s == nil {
+		return
+	}
+	if hit {
+		atomic.AddInt64(&s.hits, 1)
+	} else {
+		atomic.AddInt64(&s.misses, 1)
+	}
+}
+
+func (s *cacheStats) recordSet() {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.sets, 1)
+}
+
+func (s *cacheStats) recordRemove(reason EvictionReason) {
+	if s == nil {
+		return
+	}
+	switch reason {
+	case ReasonExpired, ReasonCapacity:
+		atomic.AddInt64(&s.evictions, 1)
+	default:
+		atomic.AddInt64(&s.deletes, 1)
+	}
+}
+
+// Stats get the statistics of the cache
+// It returns zero values if WithStats is not set
+func (c *mapCache[K, E]) Stats() CacheStats {
+	if c.stats == nil {
+		return CacheStats{}
+	}
+	c.mu.RLock()
+	entries, bytes := len(c.items), c.bytes
+	c.mu.RUnlock()
+	return CacheStats{
+		Hits:      atomic.LoadInt64(&c.stats.hits),
+		Misses:    atomic.LoadInt64(&c.stats.misses),
+		Sets:      atomic.LoadInt64(&c.stats.sets),
+		Evictions: atomic.LoadInt64(&c.stats.evictions),
+		Deletes:   atomic.LoadInt64(&c.stats.deletes),
+		Entries:   entries,
+		Bytes:     bytes,
+	}
+}
@@ -0,0 +1,59 @@
+package cache
+
+// SetWithTags set data by key with the default expiration time and attach tags to it, see InvalidateTag
+// it will overwrite the data and its tags if the key exists, setting the data again without tags removes its tags
+// Tags are kept in memory only, they are not persisted or cloned
+func (c *mapCache[K, E]) SetWithTags(key K, value E, tags ...string) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.set(key, value, c.generateExpiration())
+	// the data may be rejected or evicted at once if the cache is full
+	item, ok := c.items[key]
+	if !ok || len(tags) == 0 {
+		return
+	}
+	if c.tags == nil {
+		c.tags = make(map[string]map[K]struct{})
+	}
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[K]struct{})
+			c.tags[tag] = keys
+		}
+		if _, ok := keys[key]; !ok {
+			keys[key] = struct{}{}
+			item.tags = append(item.tags, tag)
+		}
+	}
+}
+
+// InvalidateTag delete all data carrying tag, and return the number of data deleted
+// Expired data that carries tag is also removed but not counted
+func (c *mapCache[K, E]) InvalidateTag(tag string) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := 0
+	now := c.now()
+	for k := range c.tags[tag] {
+		if c.items[k].expired(now) {
+			c.del(k, ReasonExpired)
+			continue
+		}
+		c.del(k, ReasonDeleted)
+		count++
+	}
+	return count
+}
+
+// remove the key from the index of the tags of the data, it is called when the data is overwritten or removed
+func (c *mapCache[K, E]) untag(key K, item *Item[E]) {
+	for _, tag := range item.tags {
+		keys := c.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	item.tags = nil
+}
@@ -0,0 +1,445 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// suffix of the files of the cold tier
+const coldSuffix = ".cold"
+
+// the cold tier of a cache, it takes the data evicted from the hot tier
+type overflowStore[K comparable, E any] interface {
+	// store the data evicted because the cache is full, the data leaves the cache if it returns an error
+	put(key K, item *Item[E]) error
+	// drop the data that is set into the hot tier again
+	remove(key K)
+	// drop the expired data, and return it
+	deleteExpired(now int64) map[K]*Item[E]
+}
+
+// TieredCache a cache with a small hot tier in memory and a cold tier on disk
+// The least recently used data is moved to the cold tier instead of being evicted when the hot tier is full,
+// and it is moved back to the hot tier when it is accessed by key
+// Each data of the cold tier is a file in the cold folder, written with the persistence codec,
+// the files of expired data are removed by DeleteExpired and the gc
+// Len, Keys and Clear cover both tiers, other operations over all data such as Range, Items, Export, Save and Clone
+// only see the hot tier
+type TieredCache[E any] struct {
+	*MapCache[E]
+	cold *coldStore[E]
+}
+
+// NewTieredCache create a cache that keeps at most hotSize data in memory and moves the rest to coldDir
+// The options apply to the hot tier, except that the maximum number of data is hotSize
+// Files of the cold tier left in coldDir are removed, the folder is created if WithCreateDirs is set
+func NewTieredCache[E any](hotSize int, coldDir string, opts ...CreateOptionFunc) (MapInterface[E], error) {
+	if hotSize <= 0 {
+		return nil, errors.New("the size of the hot tier must be greater than 0")
+	}
+	exp := newOption()
+	for _, opt := range opts {
+		opt(&exp)
+	}
+	exp.maxEntries = hotSize
+	if err := checkWritable(filepath.Join(coldDir, "cold"), exp.createDirs); err != nil {
+		return nil, err
+	}
+	cold := &coldStore[E]{dir: coldDir, codec: exp.persistenceCodec}
+	if cold.codec == nil {
+		cold.codec = GobCodec{}
+	}
+	if err := cold.clear(); err != nil {
+		return nil, fmt.Errorf("can not clear the cold folder %s: %w", coldDir, err)
+	}
+	res, err := createMapCache[string, E](exp)
+	if err != nil {
+		return nil, err
+	}
+	res.overflow = cold
+	return &TieredCache[E]{wrapMapCache(res), cold}, nil
+}
+
+// move the data from the cold tier to the hot tier if it is not in the hot tier
+func (c *TieredCache[E]) promote(keys ...string) {
+	c.mu.Lock()
+	defer c.unlock()
+	for _, key := range keys {
+		if _, ok := c.items[key]; ok {
+			continue
+		}
+		item, ok := c.cold.get(key)
+		if !ok {
+			continue
+		}
+		if item.expired(c.now()) {
+			c.cold.remove(key)
+			c.dropOverflow(key, item, ReasonExpired)
+			continue
+		}
+		// setting the data removes it from the cold tier
+		c.store(key, c.repack(item.Object), item.Expiration)
+	}
+}
+
+func (c *TieredCache[E]) Get(key string) (E, bool) {
+	c.promote(key)
+	return c.MapCache.Get(key)
+}
+
+func (c *TieredCache[E]) MustGet(key string) (E, error) {
+	c.promote(key)
+	return c.MapCache.MustGet(key)
+}
+
+func (c *TieredCache[E]) GetOrDefault(key string, def E) E {
+	c.promote(key)
+	return c.MapCache.GetOrDefault(key, def)
+}
+
+// Peek get data of either tier without side effects, data of the cold tier stays in the cold tier
+func (c *TieredCache[E]) Peek(key string) (E, bool) {
+	if value, ok := c.MapCache.Peek(key); ok {
+		return value, true
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if _, ok := c.items[key]; !ok {
+		if item, ok := c.cold.get(key); ok && !item.expired(c.now()) {
+			return c.unpack(item.Object), true
+		}
+	}
+	var zero E
+	return zero, false
+}
+
+func (c *TieredCache[E]) GetLoad(key string) (E, error) {
+	c.promote(key)
+	return c.MapCache.GetLoad(key)
+}
+
+func (c *TieredCache[E]) GetAndDelete(key string) (E, bool) {
+	c.promote(key)
+	return c.MapCache.GetAndDelete(key)
+}
+
+func (c *TieredCache[E]) GetAndExpired(key string) (E, bool) {
+	c.promote(key)
+	return c.MapCache.GetAndExpired(key)
+}
+
+func (c *TieredCache[E]) GetStale(key string) (E, bool, bool) {
+	c.promote(key)
+	return c.MapCache.GetStale(key)
+}
+
+func (c *TieredCache[E]) GetWithExpiration(key string) (E, time.Time, bool) {
+	c.promote(key)
+	return c.MapCache.GetWithExpiration(key)
+}
+
+func (c *TieredCache[E]) GetWithStatus(key string) (E, Status) {
+	c.promote(key)
+	return c.MapCache.GetWithStatus(key)
+}
+
+func (c *TieredCache[E]) TTL(key string) (time.Duration, bool) {
+	c.promote(key)
+	return c.MapCache.TTL(key)
+}
+
+func (c *TieredCache[E]) IsExpired(key string) (bool, error) {
+	c.promote(key)
+	return c.MapCache.IsExpired(key)
+}
+
+func (c *TieredCache[E]) ExpiryInfo(key string) (ExpiryStatus, error) {
+	c.promote(key)
+	return c.MapCache.ExpiryInfo(key)
+}
+
+func (c *TieredCache[E]) Touch(key string, ttl time.Duration) bool {
+	c.promote(key)
+	return c.MapCache.Touch(key, ttl)
+}
+
+func (c *TieredCache[E]) GetTouch(key string, extend time.Duration) (E, bool) {
+	c.promote(key)
+	return c.MapCache.GetTouch(key, extend)
+}
+
+func (c *TieredCache[E]) ExpireAt(key string, at time.Time) bool {
+	c.promote(key)
+	return c.MapCache.ExpireAt(key, at)
+}
+
+// Delete delete data by key, data of the cold tier is removed from the cold tier without being moved to the hot tier
+func (c *TieredCache[E]) Delete(key string) (E, bool) {
+	if value, ok := c.deleteCold(key); ok {
+		return value, true
+	}
+	return c.MapCache.Delete(key)
+}
+
+// delete the data of the cold tier if it is not in the hot tier, and report whether it was found and not expired
+func (c *TieredCache[E]) deleteCold(key string) (E, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	var zero E
+	if _, ok := c.items[key]; ok {
+		return zero, false
+	}
+	item, ok := c.cold.get(key)
+	if !ok {
+		return zero, false
+	}
+	c.cold.remove(key)
+	if item.expired(c.now()) {
+		c.dropOverflow(key, item, ReasonExpired)
+		return zero, false
+	}
+	c.dropOverflow(key, item, ReasonDeleted)
+	return c.inflate(item.Object), true
+}
+
+func (c *TieredCache[E]) Add(key string, value E) error {
+	c.promote(key)
+	return c.MapCache.Add(key, value)
+}
+
+func (c *TieredCache[E]) AddWithTTL(key string, value E, ttl time.Duration) error {
+	c.promote(key)
+	return c.MapCache.AddWithTTL(key, value, ttl)
+}
+
+func (c *TieredCache[E]) Replace(key string, value E) error {
+	c.promote(key)
+	return c.MapCache.Replace(key, value)
+}
+
+func (c *TieredCache[E]) ReplaceKeepTTL(key string, value E) error {
+	c.promote(key)
+	return c.MapCache.ReplaceKeepTTL(key, value)
+}
+
+func (c *TieredCache[E]) CompareAndSwap(key string, oldValue, newValue E, eq func(a, b E) bool) bool {
+	c.promote(key)
+	return c.MapCache.CompareAndSwap(key, oldValue, newValue, eq)
+}
+
+func (c *TieredCache[E]) CompareAndDelete(key string, oldValue E, eq func(a, b E) bool) bool {
+	c.promote(key)
+	return c.MapCache.CompareAndDelete(key, oldValue, eq)
+}
+
+func (c *TieredCache[E]) Rename(oldKey, newKey string) bool {
+	c.promote(oldKey, newKey)
+	return c.MapCache.Rename(oldKey, newKey)
+}
+
+func (c *TieredCache[E]) Update(key string, fn func(old E, exists bool) (E, bool)) (E, bool) {
+	c.promote(key)
+	return c.MapCache.Update(key, fn)
+}
+
+func (c *TieredCache[E]) SetReport(key string, value E) bool {
+	c.promote(key)
+	return c.MapCache.SetReport(key, value)
+}
+
+func (c *TieredCache[E]) SetIfAbsent(key string, value E, ttl time.Duration) bool {
+	c.promote(key)
+	return c.MapCache.SetIfAbsent(key, value, ttl)
+}
+
+func (c *TieredCache[E]) GetOrSet(key string, value E) (E, bool, error) {
+	c.promote(key)
+	return c.MapCache.GetOrSet(key, value)
+}
+
+func (c *TieredCache[E]) GetAndSet(key string, value E) (E, bool, error) {
+	c.promote(key)
+	return c.MapCache.GetAndSet(key, value)
+}
+
+func (c *TieredCache[E]) GetOrCompute(key string, fn func() (E, error)) (E, error) {
+	c.promote(key)
+	return c.MapCache.GetOrCompute(key, fn)
+}
+
+func (c *TieredCache[E]) GetOrComputeCtx(ctx context.Context, key string, fn func(context.Context) (E, error)) (E, error) {
+	c.promote(key)
+	return c.MapCache.GetOrComputeCtx(ctx, key, fn)
+}
+
+func (c *TieredCache[E]) WaitGet(ctx context.Context, key string) (E, error) {
+	c.promote(key)
+	return c.MapCache.WaitGet(ctx, key)
+}
+
+func (c *TieredCache[E]) GetMany(keys []string) map[string]E {
+	c.promote(keys...)
+	return c.MapCache.GetMany(keys)
+}
+
+func (c *TieredCache[E]) GetManyCtx(ctx context.Context, keys []string) (map[string]E, error) {
+	c.promote(keys...)
+	return c.MapCache.GetManyCtx(ctx, keys)
+}
+
+func (c *TieredCache[E]) GetAndDeleteMany(keys []string) map[string]E {
+	c.promote(keys...)
+	return c.MapCache.GetAndDeleteMany(keys)
+}
+
+func (c *TieredCache[E]) DeleteMany(keys []string) {
+	for _, key := range keys {
+		_, _ = c.deleteCold(key)
+	}
+	c.MapCache.DeleteMany(keys)
+}
+
+// Keys get all keys of both tiers
+// Expired data that has not been cleaned up is skipped, it reads every file of the cold tier
+// and removes the files of expired data
+func (c *TieredCache[E]) Keys() []string {
+	c.mu.Lock()
+	defer c.unlock()
+	res := make([]string, 0, len(c.items))
+	now := c.now()
+	for k, v := range c.items {
+		if !v.expired(now) {
+			res = append(res, k)
+		}
+	}
+	for _, k := range c.cold.keys() {
+		item, ok := c.cold.get(k)
+		if !ok {
+			continue
+		}
+		if item.expired(now) {
+			c.cold.remove(k)
+			c.dropOverflow(k, item, ReasonExpired)
+			continue
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+// Len get the number of data of both tiers
+// Expired data that has not been cleaned up is not counted, it reads every file of the cold tier
+func (c *TieredCache[E]) Len() int {
+	return len(c.Keys())
+}
+
+// Clear remove all data of both tiers
+func (c *TieredCache[E]) Clear() {
+	c.MapCache.Clear()
+	c.mu.Lock()
+	defer c.unlock()
+	_ = c.cold.clear()
+}
+
+// Close close the hot tier and remove the files of the cold tier
+func (c *TieredCache[E]) Close() error {
+	err := c.MapCache.Close()
+	c.mu.Lock()
+	defer c.unlock()
+	if clearErr := c.cold.clear(); err == nil {
+		err = clearErr
+	}
+	return err
+}
+
+// ReadOnly get a read-only view of the cache, it shares the data with the cache
+func (c *TieredCache[E]) ReadOnly() ReadOnlyMap[E] {
+	return readOnlyMap[E]{c}
+}
+
+// coldStore the cold tier of a TieredCache, it is only accessed under the write lock of the hot tier
+type coldStore[E any] struct {
+	dir   string
+	codec Codec
+}
+
+// the file of the key, the key is encoded so that it is a valid file name
+func (s *coldStore[E]) path(key string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(key))+coldSuffix)
+}
+
+func (s *coldStore[E]) put(key string, item *Item[E]) error {
+	data, err := s.codec.Marshal(&Item[E]{Object: item.Object, Expiration: item.Expiration})
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(s.path(key), data, 0644); err != nil {
+		// do not leave a partial file behind
+		_ = os.Remove(s.path(key))
+	}
+	return err
+}
+
+func (s *coldStore[E]) remove(key string) {
+	_ = os.Remove(s.path(key))
+}
+
+func (s *coldStore[E]) get(key string) (*Item[E], bool) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var item Item[E]
+	if s.codec.Unmarshal(data, &item) != nil {
+		return nil, false
+	}
+	return &item, true
+}
+
+func (s *coldStore[E]) deleteExpired(now int64) map[string]*Item[E] {
+	res := make(map[string]*Item[E])
+	for _, key := range s.keys() {
+		if item, ok := s.get(key); ok && item.expired(now) {
+			s.remove(key)
+			res[key] = item
+		}
+	}
+	return res
+}
+
+// get the keys of all files of the cold tier
+func (s *coldStore[E]) keys() []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	res := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, coldSuffix) {
+			continue
+		}
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(name, coldSuffix))
+		if err != nil {
+			continue
+		}
+		res = append(res, string(key))
+	}
+	return res
+}
+
+// remove all files of the cold tier
+func (s *coldStore[E]) clear() error {
+	for _, key := range s.keys() {
+		if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package cache
+
+import "context"
+
+// WaitGet get data, or block until the data is set when it does not exist or expires
+// It returns ctx.Err() if ctx is done before the data is set, the loader is not called
+func (c *mapCache[K, E]) WaitGet(ctx context.Context, key K) (E, error) {
+	for {
+		c.mu.Lock()
+		if value, ok := c.get(key); ok {
+			c.access(key, value)
+			res := c.unpack(value.Object)
+			c.unlock()
+			return res, nil
+		}
+		ch := c.addWaiter(key)
+		c.unlock()
+		select {
+		case <-ch:
+			// the data is set, it is read again as it may be deleted or expire in the meantime
+		case <-ctx.Done():
+			c.mu.Lock()
+			c.removeWaiter(key, ch)
+			c.unlock()
+			var zero E
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// register a channel that is closed when the data of the key is set, it must be called under the write lock
+func (c *mapCache[K, E]) addWaiter(key K) chan struct{} {
+	if c.waiters == nil {
+		c.waiters = make(map[K][]chan struct{})
+	}
+	ch := make(chan struct{})
+	c.waiters[key] = append(c.waiters[key], ch)
+	return ch
+}
+
+// unregister a channel of the key that is no longer waited for
+func (c *mapCache[K, E]) removeWaiter(key K, ch chan struct{}) {
+	waiters := c.waiters[key]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(c.waiters, key)
+		return
+	}
+	c.waiters[key] = waiters
+}
+
+// wake up the goroutines waiting for the data of the key, it is called by set
+func (c *mapCache[K, E]) notifyWaiters(key K) {
+	for _, ch := range c.waiters[key] {
+		close(ch)
+	}
+	delete(c.waiters, key)
+}
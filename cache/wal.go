@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// operations recorded in the write-ahead log
+const (
+	walSet byte = iota
+	walDelete
+	walClear
+)
+
+// a change of the data recorded in the write-ahead log
+// The fields are exported so that the persistence codec can serialize them
+type walRecord[K comparable, E any] struct {
+	Op         byte
+	Key        K
+	Value      E
+	Expiration int64
+}
+
+// The write-ahead log is a sequence of records, each record is the length of the encoded record
+// in 4 bytes big-endian followed by the record encoded with the persistence codec.
+// Every change is appended under the write lock, and the log is emptied after each snapshot is written,
+// so on start the snapshot is loaded first and then the log is replayed.
+
+// replay the write-ahead log on the data loaded from the snapshot, and open it for appending
+// A record that is only partially written, for example because the process crashed, ends the replay
+// and is cut off the log, so that new records are not appended after it
+func (c *mapCache[K, E]) openWal() error {
+	data, err := os.ReadFile(c.walPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	offset := 0
+	for len(data)-offset >= 4 {
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		if len(data)-offset-4 < size {
+			break
+		}
+		var record walRecord[K, E]
+		if c.persistenceCodec.Unmarshal(data[offset+4:offset+4+size], &record) != nil {
+			break
+		}
+		c.replay(record)
+		offset += 4 + size
+	}
+	f, err := os.OpenFile(c.walPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(int64(offset))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	c.wal = f
+	return nil
+}
+
+// apply a record of the write-ahead log to the data
+func (c *mapCache[K, E]) replay(record walRecord[K, E]) {
+	switch record.Op {
+	case walSet:
+		c.items[record.Key] = &Item[E]{Object: record.Value, Expiration: record.Expiration}
+	case walDelete:
+		delete(c.items, record.Key)
+	case walClear:
+		c.items = c.newItems()
+	}
+}
+
+// append a record to the write-ahead log, it does nothing if the log is not enabled
+// It is called under the write lock, an error is sent to PersistErrors like the errors of the periodic backup
+func (c *mapCache[K, E]) appendWal(record walRecord[K, E]) {
+	if c.wal == nil {
+		return
+	}
+	data, err := c.persistenceCodec.Marshal(record)
+	if err == nil {
+		buf := make([]byte, 4, 4+len(data))
+		binary.BigEndian.PutUint32(buf, uint32(len(data)))
+		_, err = c.wal.Write(append(buf, data...))
+	}
+	if err != nil {
+		c.reportPersistError(fmt.Errorf("can not append to the write-ahead log %s: %w", c.walPath, err))
+	}
+}
+
+// record that the data is set
+func (c *mapCache[K, E]) logSet(key K, value E, expiration int64) {
+	c.appendWal(walRecord[K, E]{Op: walSet, Key: key, Value: value, Expiration: expiration})
+}
+
+// record that the data is deleted
+func (c *mapCache[K, E]) logDelete(key K) {
+	c.appendWal(walRecord[K, E]{Op: walDelete, Key: key})
+}
+
+// record that all data is removed
+func (c *mapCache[K, E]) logClear() {
+	c.appendWal(walRecord[K, E]{Op: walClear})
+}
+
+// empty the write-ahead log after a snapshot is written, it must be called under the lock
+func (c *mapCache[K, E]) truncateWal() error {
+	if c.wal == nil {
+		return nil
+	}
+	return c.wal.Truncate(0)
+}
+
+// close the write-ahead log
+func (c *mapCache[K, E]) closeWal() error {
+	if c.wal == nil {
+		return nil
+	}
+	err := c.wal.Close()
+	c.wal = nil
+	return err
+}
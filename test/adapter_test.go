@@ -0,0 +1,51 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lomtom/go-utils/assert"
+	"github.com/lomtom/go-utils/cache"
+	"github.com/lomtom/go-utils/cache/adapter"
+)
+
+func TestAdapter(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	var ac adapter.Cache[int] = adapter.New(c)
+	ctx := context.Background()
+
+	a.Equal(nil, ac.Set(ctx, "a", 1, time.Minute))
+	a.Equal(nil, ac.Set(ctx, "default", 2, 0))
+	a.Equal(nil, ac.Set(ctx, "never", 3, -1))
+	value, err := ac.Get(ctx, "a")
+	a.Equal(nil, err)
+	a.Equal(1, value)
+	ttl, _ := c.TTL("a")
+	a.Equal(time.Minute, ttl)
+	ttl, _ = c.TTL("default")
+	a.Equal(time.Hour, ttl)
+	ttl, _ = c.TTL("never")
+	a.Equal(cache.DefaultExpiration, ttl)
+	clock.Advance(time.Minute * 2)
+	_, err = ac.Get(ctx, "a")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+
+	a.Equal(nil, ac.Delete(ctx, "default"))
+	a.Equal(nil, ac.Delete(ctx, "missing"))
+	a.Equal([]string{"never"}, c.Keys())
+	a.Equal(nil, ac.Clear(ctx))
+	a.Equal(0, c.Len())
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	a.Equal(context.Canceled, ac.Set(canceled, "a", 1, 0))
+	_, err = ac.Get(canceled, "a")
+	a.Equal(context.Canceled, err)
+	a.Equal(0, c.Len())
+	a.Equal(c, adapter.New(c).Unwrap())
+}
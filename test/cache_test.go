@@ -1,16 +1,28 @@
 package test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lomtom/go-utils/assert"
 	"github.com/lomtom/go-utils/cache"
+	"github.com/lomtom/go-utils/slice"
 
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestBackup(t *testing.T) {
-	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Minute), cache.SetGcInterval(time.Second*10), cache.SetEnablePersistence("test"), cache.SetPersistencePath("/tmp/cache/persistence"))
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Minute), cache.SetGcInterval(time.Second*10), cache.SetEnablePersistence("test"), cache.SetPersistencePath("/tmp/cache/persistence"), cache.WithCreateDirs())
 	if err != nil {
 		fmt.Println("err:", err)
 		return
@@ -45,3 +57,3505 @@ func TestGc(t *testing.T) {
 		index += 1
 	}
 }
+
+func TestStopGc(t *testing.T) {
+	a := assert.NewAssert(t)
+	baseline := runtime.NumGoroutine()
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Millisecond*10), cache.SetGcInterval(time.Millisecond))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	time.Sleep(time.Millisecond * 20)
+	a.Equal(nil, c.StopGc())
+	// stop again does nothing
+	a.Equal(nil, c.StopGc())
+	a.Equal(baseline, runtime.NumGoroutine())
+
+	a.Equal(nil, c.StartGc())
+	a.Equal(baseline+1, runtime.NumGoroutine())
+	a.Equal(nil, c.StopGc())
+	a.Equal(baseline, runtime.NumGoroutine())
+}
+
+func TestKeysAndClear(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.SetDefault("2", 2, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+	a.Equal([]string{"1"}, c.Keys())
+	c.Clear()
+	a.Equal([]string{}, c.Keys())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Set(strconv.Itoa(i*1000+j), j)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = c.Keys()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Clear()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSetAfterClear(t *testing.T) {
+	a := assert.NewAssert(t)
+	var cleared int64
+	c, err := cache.NewMapCache[int](cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+		if reason == cache.ReasonCleared {
+			atomic.AddInt64(&cleared, 1)
+		}
+	}))
+	a.Equal(nil, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if j%50 == 0 {
+					c.Clear()
+				}
+				c.Set(fmt.Sprintf("%d_%d", i, j), j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// every data is either in the cache or reported as cleared, none is lost in a replaced map
+	a.Equal(int64(8*500), int64(c.Len())+atomic.LoadInt64(&cleared))
+	a.Equal(c.Len(), len(c.Keys()))
+}
+
+func TestLen(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	a.Equal(0, c.Len())
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.SetDefault("3", 3, time.Millisecond)
+	c.SetDefault("4", 4, time.Millisecond)
+	c.SetDefault("5", 5, time.Hour)
+	a.Equal(5, c.Len())
+	time.Sleep(time.Millisecond * 2)
+	a.Equal(3, c.Len())
+}
+
+func TestMaxEntries(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(3))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Set("3", 3)
+	// 1 becomes the most recently used, 2 will be evicted
+	_, ok := c.Get("1")
+	a.Equal(true, ok)
+	c.Set("4", 4)
+	a.Equal(3, c.Len())
+	_, ok = c.Get("2")
+	a.Equal(false, ok)
+	// overwrite does not evict
+	c.Set("3", 30)
+	a.Equal(3, c.Len())
+	// 1 is the least recently used now
+	a.Equal(nil, c.Add("5", 5))
+	_, ok = c.Get("1")
+	a.Equal(false, ok)
+	value, ok := c.Get("3")
+	a.Equal(true, ok)
+	a.Equal(30, value)
+
+	// deleted data does not take up space
+	c.Delete("3")
+	c.Set("6", 6)
+	a.Equal(3, c.Len())
+	_, ok = c.Get("4")
+	a.Equal(true, ok)
+
+	// expired data is evicted in the same order
+	c.Clear()
+	c.SetDefault("1", 1, time.Millisecond)
+	c.Set("2", 2)
+	c.Set("3", 3)
+	time.Sleep(time.Millisecond * 2)
+	c.DeleteExpired()
+	c.Set("4", 4)
+	c.Set("5", 5)
+	a.Equal(3, c.Len())
+	_, ok = c.Get("2")
+	a.Equal(false, ok)
+}
+
+func benchmarkSet(b *testing.B, opts ...cache.CreateOptionFunc) {
+	c, _ := cache.NewMapCache[int](opts...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Set(strconv.Itoa(i%10000), i)
+	}
+}
+
+func benchmarkGet(b *testing.B, opts ...cache.CreateOptionFunc) {
+	c, _ := cache.NewMapCache[int](opts...)
+	for i := 0; i < 10000; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(strconv.Itoa(i % 10000))
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	benchmarkSet(b)
+}
+
+func BenchmarkSetWithMaxEntries(b *testing.B) {
+	benchmarkSet(b, cache.WithMaxEntries(5000))
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkGet(b)
+}
+
+func BenchmarkGetWithMaxEntries(b *testing.B) {
+	benchmarkGet(b, cache.WithMaxEntries(10000))
+}
+
+func BenchmarkLoad(b *testing.B) {
+	benchmarkLoad(b)
+}
+
+func BenchmarkLoadWithInitialCapacity(b *testing.B) {
+	benchmarkLoad(b, cache.WithInitialCapacity(1000000))
+}
+
+// measure loading 1M data into a new cache
+func benchmarkLoad(b *testing.B, opts ...cache.CreateOptionFunc) {
+	keys := make([]string, 1000000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, _ := cache.NewMapCache[int](opts...)
+		for j, key := range keys {
+			c.Set(key, j)
+		}
+		_ = c.Close()
+	}
+}
+
+// measure the maximum latency of Get while gc scans a cache of 1M data
+func benchmarkGetDuringGc(b *testing.B, opts ...cache.CreateOptionFunc) {
+	c, _ := cache.NewMapCache[int](opts...)
+	items := make(map[string]int, 1000000)
+	for i := 0; i < 1000000; i++ {
+		items[strconv.Itoa(i)] = i
+	}
+	c.SetMany(items)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				c.DeleteExpired()
+			}
+		}
+	}()
+	var maxLatency time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		c.Get(strconv.Itoa(i % 1000000))
+		if latency := time.Since(start); latency > maxLatency {
+			maxLatency = latency
+		}
+	}
+	b.StopTimer()
+	close(stop)
+	<-done
+	b.ReportMetric(float64(maxLatency.Microseconds()), "max-us")
+}
+
+func BenchmarkGetDuringGc(b *testing.B) {
+	benchmarkGetDuringGc(b)
+}
+
+func BenchmarkGetDuringGcWithBatchSize(b *testing.B) {
+	benchmarkGetDuringGc(b, cache.WithGcBatchSize(1000))
+}
+
+// measure how long Clear holds the lock, which is the time until the first eviction callback is called
+// as the callbacks are called after the lock is released
+func benchmarkClear(b *testing.B, n int) {
+	var start time.Time
+	var lockHold time.Duration
+	first := true
+	c, _ := cache.NewMapCache[int](cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+		if first {
+			lockHold += time.Since(start)
+			first = false
+		}
+	}))
+	items := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		items[strconv.Itoa(i)] = i
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c.SetMany(items)
+		first = true
+		b.StartTimer()
+		start = time.Now()
+		c.Clear()
+	}
+	b.StopTimer()
+	_ = c.Close()
+	b.ReportMetric(float64(lockHold.Nanoseconds())/float64(b.N), "lock-ns/op")
+}
+
+func BenchmarkClear1K(b *testing.B) {
+	benchmarkClear(b, 1000)
+}
+
+func BenchmarkClear100K(b *testing.B) {
+	benchmarkClear(b, 100000)
+}
+
+func TestSetWithTTL(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Millisecond * 20))
+	a.Equal(nil, err)
+	c.SetWithTTL("short", 1, time.Millisecond*5)
+	c.SetWithTTL("long", 2, time.Hour)
+	c.SetWithTTL("default", 3, 0)
+	c.SetWithTTL("never", 4, -1)
+	a.Equal(nil, c.AddWithTTL("add", 5, time.Millisecond*5))
+	a.Equal(false, c.AddWithTTL("long", 6, time.Hour) == nil)
+
+	time.Sleep(time.Millisecond * 10)
+	_, ok := c.Get("short")
+	a.Equal(false, ok)
+	_, ok = c.Get("add")
+	a.Equal(false, ok)
+	value, ok := c.Get("long")
+	a.Equal(true, ok)
+	a.Equal(2, value)
+	_, ok = c.Get("default")
+	a.Equal(true, ok)
+
+	time.Sleep(time.Millisecond * 20)
+	_, ok = c.Get("default")
+	a.Equal(false, ok)
+	_, ok = c.Get("never")
+	a.Equal(true, ok)
+}
+
+func TestDeleteExpired(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	for i := 0; i < 10; i++ {
+		c.SetWithTTL(strconv.Itoa(i), i, time.Minute)
+	}
+	c.Set("persistent", 0)
+	a.Equal(0, c.DeleteExpired())
+	clock.Advance(time.Minute * 2)
+	a.Equal(10, c.DeleteExpired())
+	a.Equal(0, c.DeleteExpired())
+	a.Equal([]string{"persistent"}, c.Keys())
+
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	for i := 0; i < 10; i++ {
+		s.SetWithTTL(strconv.Itoa(i), i, time.Minute)
+	}
+	clock.Advance(time.Minute * 2)
+	a.Equal(10, s.DeleteExpired())
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	a.Equal(true, c.SetIfAbsent("1", 1, time.Minute))
+	a.Equal(false, c.SetIfAbsent("1", 2, time.Minute))
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+
+	clock.Advance(time.Minute * 2)
+	a.Equal(true, c.SetIfAbsent("1", 3, -1))
+	value, ok = c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(3, value)
+	ttl, ok := c.TTL("1")
+	a.Equal(true, ok)
+	a.Equal(cache.DefaultExpiration, ttl)
+}
+
+func TestGcBatchSize(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithGcBatchSize(10))
+	a.Equal(nil, err)
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			c.SetWithTTL(strconv.Itoa(i), i, time.Minute)
+		} else {
+			c.Set(strconv.Itoa(i), i)
+		}
+	}
+	clock.Advance(time.Minute * 2)
+
+	// data set while the lock is released is not deleted
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.Set("new"+strconv.Itoa(i), i)
+		}
+	}()
+	a.Equal(500, c.DeleteExpired())
+	wg.Wait()
+	a.Equal(600, c.Len())
+}
+
+func TestGetOrSet(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	value, ok, err := c.GetOrSet("1", 1)
+	a.Equal(nil, err)
+	a.Equal(false, ok)
+	a.Equal(1, value)
+	value, ok, err = c.GetOrSet("1", 2)
+	a.Equal(nil, err)
+	a.Equal(true, ok)
+	a.Equal(1, value)
+
+	// the data is rejected when the cache is full
+	c, err = cache.NewMapCache[int](cache.WithMaxEntries(1), cache.WithFullPolicy(cache.RejectNew))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	value, ok, err = c.GetOrSet("2", 2)
+	a.Equal(cache.ErrCacheFull, err)
+	a.Equal(false, ok)
+	a.Equal(0, value)
+	_, ok = c.Get("2")
+	a.Equal(false, ok)
+}
+
+func TestGetAndSet(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[string](cache.SetExpirationTime(time.Millisecond * 50))
+	a.Equal(nil, err)
+	defer c.Close()
+	previous, ok, err := c.GetAndSet("token", "a")
+	a.Equal(nil, err)
+	a.Equal(false, ok)
+	a.Equal("", previous)
+
+	time.Sleep(time.Millisecond * 30)
+	previous, ok, err = c.GetAndSet("token", "b")
+	a.Equal(nil, err)
+	a.Equal(true, ok)
+	a.Equal("a", previous)
+	time.Sleep(time.Millisecond * 30)
+	value, ok := c.Get("token")
+	a.Equal(true, ok)
+	a.Equal("b", value)
+	ttl, ok := c.TTL("token")
+	a.Equal(true, ok)
+	a.Equal(true, ttl > 0 && ttl <= time.Millisecond*20)
+
+	// the data is rejected when the cache is full
+	full, err := cache.NewMapCache[string](cache.WithMaxEntries(1), cache.WithFullPolicy(cache.RejectNew))
+	a.Equal(nil, err)
+	full.Set("1", "a")
+	previous, ok, err = full.GetAndSet("2", "b")
+	a.Equal(cache.ErrCacheFull, err)
+	a.Equal(false, ok)
+	a.Equal("", previous)
+	_, ok = full.Get("2")
+	a.Equal(false, ok)
+}
+
+func TestSetMiss(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	defer c.Close()
+	value, status := c.GetWithStatus("1")
+	a.Equal(cache.StatusUnknown, status)
+	a.Equal(0, value)
+
+	c.Set("1", 1)
+	value, status = c.GetWithStatus("1")
+	a.Equal(cache.StatusHit, status)
+	a.Equal(1, value)
+
+	c.SetMiss("1", time.Millisecond*20)
+	value, status = c.GetWithStatus("1")
+	a.Equal(cache.StatusMiss, status)
+	a.Equal(0, value)
+	_, ok := c.Get("1")
+	a.Equal(false, ok)
+	a.Equal(0, c.Len())
+
+	time.Sleep(time.Millisecond * 30)
+	_, status = c.GetWithStatus("1")
+	a.Equal(cache.StatusUnknown, status)
+
+	c.SetMiss("2", 0)
+	_, status = c.GetWithStatus("2")
+	a.Equal(cache.StatusMiss, status)
+	c.Set("2", 2)
+	value, status = c.GetWithStatus("2")
+	a.Equal(cache.StatusHit, status)
+	a.Equal(2, value)
+
+	c.SetMiss("3", -1)
+	c.Delete("3")
+	_, status = c.GetWithStatus("3")
+	a.Equal(cache.StatusUnknown, status)
+}
+
+func TestGetOrCompute(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+
+	_, err = c.GetOrCompute("1", func() (int, error) {
+		return 0, errors.New("compute failed")
+	})
+	a.Equal(false, err == nil)
+	_, ok := c.Get("1")
+	a.Equal(false, ok)
+
+	var count int
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := c.GetOrCompute("1", func() (int, error) {
+				count++
+				time.Sleep(time.Millisecond)
+				return 1, nil
+			})
+			a.Equal(nil, err)
+			a.Equal(1, value)
+		}()
+	}
+	wg.Wait()
+	a.Equal(1, count)
+
+	// computations for different keys overlap
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			_, _ = c.GetOrCompute(key, func() (int, error) {
+				// fn can access the cache
+				_ = c.Len()
+				time.Sleep(time.Millisecond * 100)
+				return 2, nil
+			})
+		}(strconv.Itoa(i + 2))
+	}
+	wg.Wait()
+	a.Equal(true, time.Since(start) < time.Millisecond*190)
+}
+
+func TestOnEvicted(t *testing.T) {
+	a := assert.NewAssert(t)
+	counts := make(map[cache.EvictionReason]int)
+	var c cache.MapInterface[int]
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(3), cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+		counts[reason]++
+		// the callback can access the cache again
+		_ = c.Len()
+	}))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.SetDefault("3", 3, time.Millisecond)
+	c.Set("4", 4)
+	a.Equal(1, counts[cache.ReasonCapacity])
+
+	time.Sleep(time.Millisecond * 2)
+	c.DeleteExpired()
+	a.Equal(1, counts[cache.ReasonExpired])
+
+	c.Delete("2")
+	c.GetAndDelete("4")
+	c.Delete("5")
+	a.Equal(2, counts[cache.ReasonDeleted])
+
+	c.Set("5", 5)
+	c.Set("6", 6)
+	c.Clear()
+	a.Equal(2, counts[cache.ReasonCleared])
+
+	_, err = cache.NewMapCache[string](cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {}))
+	a.Equal(false, err == nil)
+}
+
+func TestPeek(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(3), cache.WithStats(), cache.WithAccessTracking())
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Set("3", 3)
+	value, ok := c.Peek("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	_, ok = c.Peek("missing")
+	a.Equal(false, ok)
+	a.Equal(cache.CacheStats{Sets: 3, Entries: 3, Bytes: 3}, c.Stats())
+	a.Equal(int64(0), c.TopKeys(1)[0].Count)
+
+	// the least recently used data is still evicted next
+	c.Set("4", 4)
+	_, ok = c.Peek("1")
+	a.Equal(false, ok)
+	a.Equal(3, c.Len())
+}
+
+func TestClearOnEvicted(t *testing.T) {
+	a := assert.NewAssert(t)
+	keys := make(map[string]int)
+	var c cache.MapInterface[int]
+	c, err := cache.NewMapCache[int](cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+		a.Equal(cache.ReasonCleared, reason)
+		a.Equal(key, strconv.Itoa(value))
+		keys[key]++
+		// the lock is released before the callback is called
+		a.Equal(0, c.Len())
+	}))
+	a.Equal(nil, err)
+	for i := 0; i < 100; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.Clear()
+	a.Equal(100, len(keys))
+	for i := 0; i < 100; i++ {
+		a.Equal(1, keys[strconv.Itoa(i)])
+	}
+	a.Equal(0, c.Len())
+}
+
+func TestTTL(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.SetDefault("live", 1, time.Hour)
+	c.SetDefault("expired", 2, time.Millisecond)
+	c.Set("never", 3)
+	time.Sleep(time.Millisecond * 2)
+
+	ttl, ok := c.TTL("live")
+	a.Equal(true, ok)
+	a.Equal(true, ttl > time.Hour-time.Second && ttl <= time.Hour)
+	_, ok = c.TTL("expired")
+	a.Equal(false, ok)
+	_, ok = c.TTL("none")
+	a.Equal(false, ok)
+	ttl, ok = c.TTL("never")
+	a.Equal(true, ok)
+	a.Equal(cache.DefaultExpiration, ttl)
+}
+
+func TestGetWithExpiration(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	defer c.Close()
+	now := time.Now()
+	c.Set("live", 1)
+	value, expiration, ok := c.GetWithExpiration("live")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	a.Equal(true, expiration.After(now.Add(time.Hour-time.Second)))
+	a.Equal(true, expiration.Before(now.Add(time.Hour+time.Second)))
+
+	c.SetWithTTL("persistent", 2, -1)
+	value, expiration, ok = c.GetWithExpiration("persistent")
+	a.Equal(true, ok)
+	a.Equal(2, value)
+	a.Equal(true, expiration.IsZero())
+
+	c.SetWithTTL("expired", 3, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	value, expiration, ok = c.GetWithExpiration("expired")
+	a.Equal(false, ok)
+	a.Equal(0, value)
+	a.Equal(true, expiration.IsZero())
+}
+
+func TestGetStale(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithStaleWhileRevalidate(-time.Second))
+	a.Equal(false, err == nil)
+
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Millisecond*20), cache.WithStaleWhileRevalidate(time.Millisecond*40))
+	a.Equal(nil, err)
+	defer c.Close()
+	c.Set("1", 1)
+	value, stale, ok := c.GetStale("1")
+	a.Equal(true, ok)
+	a.Equal(false, stale)
+	a.Equal(1, value)
+
+	time.Sleep(time.Millisecond * 30)
+	c.DeleteExpired()
+	_, ok = c.Get("1")
+	a.Equal(false, ok)
+	value, stale, ok = c.GetStale("1")
+	a.Equal(true, ok)
+	a.Equal(true, stale)
+	a.Equal(1, value)
+
+	time.Sleep(time.Millisecond * 40)
+	value, stale, ok = c.GetStale("1")
+	a.Equal(false, ok)
+	a.Equal(false, stale)
+	a.Equal(0, value)
+}
+
+func TestTouch(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.SetDefault("1", 1, time.Millisecond*20)
+	c.SetDefault("2", 2, time.Millisecond*20)
+	a.Equal(true, c.Touch("1", time.Hour))
+	a.Equal(false, c.Touch("3", time.Hour))
+	time.Sleep(time.Millisecond * 30)
+	_, ok := c.Get("1")
+	a.Equal(true, ok)
+	_, ok = c.Get("2")
+	a.Equal(false, ok)
+	a.Equal(false, c.Touch("2", time.Hour))
+}
+
+func TestExpireAt(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[string](cache.WithClock(clock))
+	a.Equal(nil, err)
+	now := time.UnixMicro(clock.Now())
+	c.SetExpireAt("token", "a", now.Add(time.Hour))
+	_, at, ok := c.GetWithExpiration("token")
+	a.Equal(true, ok)
+	a.Equal(now.Add(time.Hour), at)
+	clock.Advance(time.Hour + time.Second)
+	_, ok = c.Get("token")
+	a.Equal(false, ok)
+
+	now = time.UnixMicro(clock.Now())
+	c.SetExpireAt("past", "b", now.Add(-time.Second))
+	_, ok = c.Get("past")
+	a.Equal(false, ok)
+	c.SetExpireAt("now", "c", now)
+	_, ok = c.Get("now")
+	a.Equal(false, ok)
+
+	c.Set("1", "d")
+	a.Equal(true, c.ExpireAt("1", now.Add(time.Minute)))
+	ttl, ok := c.TTL("1")
+	a.Equal(true, ok)
+	a.Equal(time.Minute, ttl)
+	a.Equal(true, c.ExpireAt("1", time.Time{}))
+	ttl, _ = c.TTL("1")
+	a.Equal(cache.DefaultExpiration, ttl)
+	a.Equal(true, c.ExpireAt("1", now.Add(-time.Minute)))
+	_, ok = c.Get("1")
+	a.Equal(false, ok)
+	a.Equal(false, c.ExpireAt("1", now.Add(time.Minute)))
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Millisecond*30), cache.WithSlidingExpiration())
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	for i := 0; i < 4; i++ {
+		time.Sleep(time.Millisecond * 10)
+		_, ok := c.Get("1")
+		a.Equal(true, ok)
+	}
+	_, ok := c.Get("2")
+	a.Equal(false, ok)
+}
+
+func TestExpirationJitter(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithExpirationJitter(1))
+	a.Equal(false, err == nil)
+	_, err = cache.NewMapCache[int](cache.WithExpirationJitter(-0.1))
+	a.Equal(false, err == nil)
+
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Hour), cache.WithExpirationJitter(0.2))
+	a.Equal(nil, err)
+	defer c.Close()
+	minTTL, maxTTL := time.Duration(1<<62), time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		c.Set(strconv.Itoa(i), i)
+		ttl, ok := c.TTL(strconv.Itoa(i))
+		a.Equal(true, ok)
+		if ttl < minTTL {
+			minTTL = ttl
+		}
+		if ttl > maxTTL {
+			maxTTL = ttl
+		}
+	}
+	a.Equal(true, minTTL >= time.Minute*47)
+	a.Equal(true, maxTTL <= time.Minute*72)
+	a.Equal(true, maxTTL-minTTL > time.Minute*12)
+
+	c.SetWithTTL("ttl", 0, time.Hour*2)
+	ttl, ok := c.TTL("ttl")
+	a.Equal(true, ok)
+	a.Equal(true, ttl > time.Hour*2-time.Minute)
+}
+
+// a clock that only moves when it is advanced
+type fakeClock struct {
+	now int64
+}
+
+func (c *fakeClock) Now() int64 {
+	return atomic.LoadInt64(&c.now)
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	atomic.AddInt64(&c.now, d.Microseconds())
+}
+
+func TestClock(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithClock(nil))
+	a.Equal(false, err == nil)
+
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Hour), cache.WithClock(clock))
+	a.Equal(nil, err)
+	defer c.Close()
+	c.Set("1", 1)
+	c.SetWithTTL("2", 2, time.Hour*2)
+	clock.Advance(time.Hour - time.Second)
+	_, ok := c.Get("1")
+	a.Equal(true, ok)
+	ttl, ok := c.TTL("1")
+	a.Equal(true, ok)
+	a.Equal(time.Second, ttl)
+
+	clock.Advance(time.Second * 2)
+	_, ok = c.Get("1")
+	a.Equal(false, ok)
+	a.Equal(1, c.Len())
+	c.DeleteExpired()
+	a.Equal([]string{"2"}, c.Keys())
+}
+
+func TestIncrement(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewNumberMapCache[int64]()
+	a.Equal(nil, err)
+	_, err = c.Increment("1", 1)
+	a.Equal(false, err == nil)
+	c.Set("1", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = c.Increment("1", 2)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = c.Decrement("1", 1)
+		}()
+	}
+	wg.Wait()
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(int64(100), value)
+
+	f, err := cache.NewNumberMapCache[float64](cache.WithCreateOnIncrement())
+	a.Equal(nil, err)
+	value1, err := f.Increment("1", 1.5)
+	a.Equal(nil, err)
+	a.Equal(1.5, value1)
+	value1, err = f.Decrement("2", 1.5)
+	a.Equal(nil, err)
+	a.Equal(-1.5, value1)
+
+	// the created number is rejected when the cache is full
+	full, err := cache.NewNumberMapCache[int](cache.WithCreateOnIncrement(), cache.WithMaxEntries(1), cache.WithFullPolicy(cache.RejectNew))
+	a.Equal(nil, err)
+	value2, err := full.Increment("1", 1)
+	a.Equal(nil, err)
+	a.Equal(1, value2)
+	_, err = full.Increment("2", 1)
+	a.Equal(cache.ErrCacheFull, err)
+	_, err = full.Decrement("3", 1)
+	a.Equal(cache.ErrCacheFull, err)
+	a.Equal([]string{"1"}, full.Keys())
+}
+
+func TestMany(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.SetMany(map[string]int{"1": 1, "2": 2, "3": 3})
+	c.SetDefault("4", 4, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+	a.Equal(map[string]int{"1": 1, "3": 3}, c.GetMany([]string{"1", "3", "4", "5"}))
+	c.DeleteMany([]string{"1", "2", "5"})
+	a.Equal([]string{"3"}, c.Keys())
+}
+
+func BenchmarkSetMany(b *testing.B) {
+	items := make(map[string]int, 10000)
+	for i := 0; i < 10000; i++ {
+		items[strconv.Itoa(i)] = i
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, _ := cache.NewMapCache[int]()
+		c.SetMany(items)
+	}
+}
+
+func BenchmarkSetLoop(b *testing.B) {
+	items := make(map[string]int, 10000)
+	for i := 0; i < 10000; i++ {
+		items[strconv.Itoa(i)] = i
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, _ := cache.NewMapCache[int]()
+		for k, v := range items {
+			c.Set(k, v)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.SetMany(map[string]int{"1": 1, "2": 2, "3": 3})
+	c.SetDefault("4", 4, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+
+	items := make(map[string]int)
+	c.Range(func(key string, value int) bool {
+		items[key] = value
+		return true
+	})
+	a.Equal(map[string]int{"1": 1, "2": 2, "3": 3}, items)
+
+	count := 0
+	c.Range(func(key string, value int) bool {
+		count++
+		return count < 2
+	})
+	a.Equal(2, count)
+}
+
+func TestItems(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.SetMany(map[string]int{"1": 1, "2": 2})
+	c.SetDefault("3", 3, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+
+	items := c.Items()
+	a.Equal(map[string]int{"1": 1, "2": 2}, items)
+	items["1"] = 10
+	delete(items, "2")
+	a.Equal(map[string]int{"1": 1, "2": 2}, c.Items())
+}
+
+func TestClose(t *testing.T) {
+	a := assert.NewAssert(t)
+	baseline := runtime.NumGoroutine()
+	path := t.TempDir()
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Minute), cache.SetEnablePersistence("close"), cache.SetPersistencePath(path))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	a.Equal(nil, c.Close())
+	a.Equal(nil, c.Close())
+	a.Equal(baseline, runtime.NumGoroutine())
+	a.Equal(false, c.StartGc() == nil)
+
+	c, err = cache.NewMapCache[int](cache.SetEnablePersistence("close"), cache.SetPersistencePath(path))
+	a.Equal(nil, err)
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	a.Equal(nil, c.Close())
+}
+
+func TestAtomicPersistence(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("atomic"), cache.SetPersistencePath(path)}
+	file := filepath.Join(path, "atomic"+cache.FileSUFFIX)
+	c, err := cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	a.Equal(nil, c.Close())
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	c.Set("2", 2)
+	a.Equal(nil, c.Close())
+
+	// a crash while writing the temporary file leaves the snapshot untouched
+	data, err := os.ReadFile(file)
+	a.Equal(nil, err)
+	a.Equal(nil, os.WriteFile(file+".tmp123", data[:len(data)/2], 0644))
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"1": 1, "2": 2}, c.Items())
+	a.Equal(nil, c.Close())
+
+	// a crash between the two renames falls back to the previous snapshot
+	a.Equal(nil, os.Remove(file))
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"1": 1, "2": 2}, c.Items())
+	a.Equal(nil, c.Close())
+
+	// a corrupt snapshot falls back to the previous snapshot
+	a.Equal(nil, os.WriteFile(file, data[:len(data)/2], 0644))
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"1": 1, "2": 2}, c.Items())
+	a.Equal(nil, c.Close())
+}
+
+func TestFlush(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	a.Equal(false, c.Flush() == nil)
+
+	path := t.TempDir()
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("flush"), cache.SetPersistencePath(path)}
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	defer c.Close()
+	c.Set("1", 1)
+	c.SetWithTTL("2", 2, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.Equal(nil, c.Flush())
+		}()
+	}
+	wg.Wait()
+
+	loaded, err := cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"1": 1}, loaded.Items())
+	a.Equal(nil, loaded.Close())
+}
+
+func TestClosePersistence(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("shutdown"), cache.SetPersistencePath(path)}
+	c, err := cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.Flush()
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.Delete("0")
+	a.Equal(nil, c.Close())
+	wg.Wait()
+
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal(99, c.Len())
+	_, ok := c.Get("0")
+	a.Equal(false, ok)
+	value, ok := c.Get("99")
+	a.Equal(true, ok)
+	a.Equal(99, value)
+	a.Equal(nil, c.Close())
+}
+
+func TestWALIncrement(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("wal_increment"), cache.SetPersistencePath(path),
+		cache.WithWAL(filepath.Join(path, "wal.log"))}
+	c, err := cache.NewNumberMapCache[int](opts...)
+	a.Equal(nil, err)
+	c.Set("a", 1)
+	a.Equal(nil, c.Flush())
+	_, err = c.Increment("a", 10)
+	a.Equal(nil, err)
+	_, err = c.Decrement("a", 2)
+	a.Equal(nil, err)
+
+	// simulate a crash: copy the snapshot and the log while the cache is running
+	crashed := t.TempDir()
+	for _, name := range []string{"wal_increment" + cache.FileSUFFIX, "wal.log"} {
+		data, err := os.ReadFile(filepath.Join(path, name))
+		a.Equal(nil, err)
+		a.Equal(nil, os.WriteFile(filepath.Join(crashed, name), data, 0644))
+	}
+	a.Equal(nil, c.Close())
+	c, err = cache.NewNumberMapCache[int](cache.SetEnablePersistence("wal_increment"), cache.SetPersistencePath(crashed),
+		cache.WithWAL(filepath.Join(crashed, "wal.log")))
+	a.Equal(nil, err)
+	value, _ := c.Get("a")
+	a.Equal(9, value)
+	a.Equal(nil, c.Close())
+}
+
+func TestWAL(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithWAL(filepath.Join(t.TempDir(), "wal")))
+	a.Equal(false, err == nil)
+
+	path := t.TempDir()
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("wal"), cache.SetPersistencePath(path), cache.WithWAL(filepath.Join(path, "wal.log"))}
+	c, err := cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	a.Equal(nil, c.Flush())
+	c.Set("3", 3)
+	c.Delete("1")
+	c.SetWithTTL("4", 4, time.Hour)
+	a.Equal(true, c.Touch("4", -1))
+
+	// simulate a crash: copy the snapshot and the log while the cache is running, and cut the last record in half
+	crashed := t.TempDir()
+	for _, name := range []string{"wal" + cache.FileSUFFIX, "wal.log"} {
+		data, err := os.ReadFile(filepath.Join(path, name))
+		a.Equal(nil, err)
+		a.Equal(nil, os.WriteFile(filepath.Join(crashed, name), data, 0644))
+	}
+	a.Equal(nil, c.Close())
+	f, err := os.OpenFile(filepath.Join(crashed, "wal.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	a.Equal(nil, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	a.Equal(nil, err)
+	a.Equal(nil, f.Close())
+
+	opts = []cache.CreateOptionFunc{cache.SetEnablePersistence("wal"), cache.SetPersistencePath(crashed), cache.WithWAL(filepath.Join(crashed, "wal.log"))}
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"2": 2, "3": 3, "4": 4}, c.Items())
+	ttl, ok := c.TTL("4")
+	a.Equal(true, ok)
+	a.Equal(cache.DefaultExpiration, ttl)
+	// records appended after replay are not lost behind the partial record
+	c.Clear()
+	c.Set("5", 5)
+	snapshot, err := os.ReadFile(filepath.Join(crashed, "wal"+cache.FileSUFFIX))
+	a.Equal(nil, err)
+	log, err := os.ReadFile(filepath.Join(crashed, "wal.log"))
+	a.Equal(nil, err)
+	a.Equal(nil, c.Close())
+	a.Equal(nil, os.WriteFile(filepath.Join(crashed, "wal"+cache.FileSUFFIX), snapshot, 0644))
+	a.Equal(nil, os.WriteFile(filepath.Join(crashed, "wal.log"), log, 0644))
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"5": 5}, c.Items())
+	a.Equal(nil, c.Close())
+}
+
+func TestStats(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.WithStats(), cache.WithMaxEntries(3))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.SetDefault("3", 3, time.Millisecond)
+	c.Get("1")
+	c.Get("1")
+	c.Get("4")
+	time.Sleep(time.Millisecond * 2)
+	c.Get("3")
+	c.DeleteExpired()
+	c.Set("4", 4)
+	c.Set("5", 5)
+	c.Delete("4")
+	stats := c.Stats()
+	a.Equal(2, stats.Entries)
+	a.Equal(int64(2), stats.Bytes)
+	c.Clear()
+	a.Equal(cache.CacheStats{
+		Hits:      2,
+		Misses:    2,
+		Sets:      5,
+		Evictions: 2,
+		Deletes:   3,
+	}, c.Stats())
+
+	c, err = cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	a.Equal(cache.CacheStats{}, c.Stats())
+}
+
+func TestEvents(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithEvents(0))
+	a.Equal(false, err == nil)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	a.Equal(true, c.Events() == nil)
+
+	c, err = cache.NewMapCache[int](cache.WithEvents(10))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Delete("1")
+	c.SetWithTTL("2", 2, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	c.DeleteExpired()
+	events := c.Events()
+	a.Equal(cache.CacheEvent[string, int]{Type: cache.EventSet, Key: "1", Value: 1}, <-events)
+	a.Equal(cache.CacheEvent[string, int]{Type: cache.EventDelete, Key: "1", Value: 1}, <-events)
+	a.Equal(cache.CacheEvent[string, int]{Type: cache.EventSet, Key: "2", Value: 2}, <-events)
+	a.Equal(cache.CacheEvent[string, int]{Type: cache.EventExpire, Key: "2", Value: 2}, <-events)
+	a.Equal(int64(0), c.DroppedEvents())
+
+	// a full buffer drops events instead of blocking
+	for i := 0; i < 15; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	a.Equal(10, len(c.Events()))
+	a.Equal(int64(5), c.DroppedEvents())
+
+	s, err := cache.NewShardedMapCache[int](4, cache.WithEvents(10))
+	a.Equal(nil, err)
+	for i := 0; i < 8; i++ {
+		s.Set(strconv.Itoa(i), i)
+	}
+	a.Equal(8, len(s.Events()))
+}
+
+func TestAccessTracking(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	_, _ = c.Get("1")
+	a.Equal(true, c.TopKeys(1) == nil)
+
+	tracked, err := cache.NewMapCache[int](cache.WithAccessTracking())
+	a.Equal(nil, err)
+	sharded, err := cache.NewShardedMapCache[int](4, cache.WithAccessTracking())
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{tracked, sharded} {
+		for i := 0; i < 4; i++ {
+			key := strconv.Itoa(i)
+			c.Set(key, i)
+			for j := 0; j < i*2; j++ {
+				_, _ = c.Get(key)
+			}
+		}
+		_, _ = c.Get("missing")
+		a.Equal([]cache.KeyCount[string]{{Key: "3", Count: 6}, {Key: "2", Count: 4}}, c.TopKeys(2))
+		a.Equal([]cache.KeyCount[string]{{Key: "0", Count: 0}, {Key: "1", Count: 2}, {Key: "2", Count: 4}}, c.BottomKeys(3))
+		a.Equal(4, len(c.TopKeys(0)))
+	}
+}
+
+func TestShardedMapCache(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewShardedMapCache[int](0)
+	a.Equal(false, err == nil)
+
+	c, err := cache.NewShardedMapCache[int](4, cache.WithStats())
+	a.Equal(nil, err)
+	for i := 0; i < 100; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.SetDefault("expired", 1, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+	a.Equal(100, c.Len())
+	a.Equal(100, len(c.Keys()))
+	a.Equal(100, len(c.Items()))
+	value, ok := c.Get("10")
+	a.Equal(true, ok)
+	a.Equal(10, value)
+	a.Equal(map[string]int{"1": 1, "2": 2}, c.GetMany([]string{"1", "2", "expired"}))
+	c.DeleteMany([]string{"1", "2"})
+	a.Equal(98, c.Len())
+	c.DeleteExpired()
+	a.Equal(int64(1), c.Stats().Evictions)
+	c.Clear()
+	a.Equal(0, c.Len())
+	a.Equal(nil, c.Close())
+}
+
+func benchmarkParallelSet(b *testing.B, c cache.MapInterface[int]) {
+	b.SetParallelism(16)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Set(strconv.Itoa(i%10000), i)
+			i++
+		}
+	})
+}
+
+func BenchmarkParallelSet(b *testing.B) {
+	c, _ := cache.NewMapCache[int]()
+	benchmarkParallelSet(b, c)
+}
+
+func BenchmarkShardedParallelSet(b *testing.B) {
+	c, _ := cache.NewShardedMapCache[int](32)
+	benchmarkParallelSet(b, c)
+}
+
+func TestReplace(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	c.SetWithTTL("1", 1, time.Millisecond*20)
+	c.SetWithTTL("2", 2, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+
+	a.Equal(nil, c.Replace("1", 10))
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(10, value)
+	// the expiration time is reset to the default one
+	ttl, _ := c.TTL("1")
+	a.Equal(true, ttl > time.Minute)
+
+	a.Equal(false, c.Replace("2", 20) == nil)
+	a.Equal(false, c.Replace("3", 30) == nil)
+	_, ok = c.Get("3")
+	a.Equal(false, ok)
+}
+
+func TestPersistenceCodec(t *testing.T) {
+	a := assert.NewAssert(t)
+	type user struct {
+		Name string
+		Age  int
+	}
+	for _, codec := range []cache.Codec{cache.GobCodec{}, cache.JSONCodec{}} {
+		path := t.TempDir()
+		opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("codec"), cache.SetPersistencePath(path), cache.WithPersistenceCodec(codec)}
+		c, err := cache.NewMapCache[user](opts...)
+		a.Equal(nil, err)
+		c.Set("1", user{"lomtom", 18})
+		c.SetWithTTL("2", user{"lomtom", 19}, time.Hour)
+		c.SetWithTTL("3", user{"lomtom", 20}, time.Millisecond)
+		a.Equal(nil, c.Close())
+		time.Sleep(time.Millisecond * 2)
+
+		c, err = cache.NewMapCache[user](opts...)
+		a.Equal(nil, err)
+		a.Equal(map[string]user{"1": {"lomtom", 18}, "2": {"lomtom", 19}}, c.Items())
+		ttl, ok := c.TTL("2")
+		a.Equal(true, ok)
+		a.Equal(true, ttl > time.Minute)
+		a.Equal(nil, c.Close())
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	a := assert.NewAssert(t)
+	for _, codec := range []cache.Codec{cache.GobCodec{}, cache.JSONCodec{}} {
+		c, err := cache.NewMapCache[int](cache.WithPersistenceCodec(codec))
+		a.Equal(nil, err)
+		c.Set("1", 1)
+		c.SetWithTTL("2", 2, time.Hour)
+		c.SetWithTTL("3", 3, time.Millisecond)
+		time.Sleep(time.Millisecond * 2)
+		var buf bytes.Buffer
+		a.Equal(nil, c.Save(&buf))
+
+		s, err := cache.NewShardedMapCache[int](4, cache.WithPersistenceCodec(codec))
+		a.Equal(nil, err)
+		a.Equal(nil, s.Load(bytes.NewReader(buf.Bytes())))
+		a.Equal(map[string]int{"1": 1, "2": 2}, s.Items())
+		buf.Reset()
+		a.Equal(nil, s.Save(&buf))
+
+		c, err = cache.NewMapCache[int](cache.WithPersistenceCodec(codec))
+		a.Equal(nil, err)
+		a.Equal(nil, c.Load(&buf))
+		a.Equal(map[string]int{"1": 1, "2": 2}, c.Items())
+		ttl, _ := c.TTL("2")
+		a.Equal(true, ttl > time.Minute)
+
+		a.Equal(false, c.Load(bytes.NewReader([]byte("corrupted"))) == nil)
+		a.Equal(map[string]int{"1": 1, "2": 2}, c.Items())
+	}
+}
+
+func TestExportAndImport(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.SetWithTTL("2", 2, time.Minute)
+	c.SetWithTTL("3", 3, time.Second)
+	clock.Advance(time.Second * 2)
+	entries := c.Export()
+	a.Equal(2, len(entries))
+
+	warm, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	warm.Import(entries, true)
+	a.Equal(map[string]int{"1": 1, "2": 2}, warm.Items())
+	ttl, ok := warm.TTL("2")
+	a.Equal(true, ok)
+	a.Equal(time.Minute-time.Second*2, ttl)
+
+	expired := []cache.Entry[string, int]{{Key: "4", Value: 4, ExpirationMicros: clock.Now() - 1}}
+	warm.Import(expired, true)
+	a.Equal(2, warm.Len())
+	warm.Import(expired, false)
+	a.Equal(2, warm.Len())
+	a.Equal(1, warm.DeleteExpired())
+
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	s.Import(entries, true)
+	a.Equal(map[string]int{"1": 1, "2": 2}, s.Items())
+	a.Equal(2, len(s.Export()))
+}
+
+func TestInvalidOptions(t *testing.T) {
+	a := assert.NewAssert(t)
+	invalid := map[string][]cache.CreateOptionFunc{
+		"expiration":       {cache.SetExpirationTime(0)},
+		"gc interval":      {cache.WithGcInterval(-time.Second)},
+		"clock":            {cache.WithClock(nil)},
+		"jitter":           {cache.WithExpirationJitter(1.5)},
+		"stale grace":      {cache.WithStaleWhileRevalidate(-time.Second)},
+		"event buffer":     {cache.WithEvents(-1)},
+		"max entries":      {cache.WithMaxEntries(-1)},
+		"max bytes":        {cache.WithMaxBytes(-1)},
+		"initial capacity": {cache.WithInitialCapacity(-1)},
+		"full policy":      {cache.WithFullPolicy(-1)},
+		"eviction policy":  {cache.WithEvictionPolicy(nil)},
+		"lazy expiration":  {cache.WithLazyExpiration(), cache.WithAdaptiveGc()},
+		"persistence name": {cache.SetEnablePersistence("")},
+		"persistence path": {cache.SetEnablePersistence("invalid"), cache.SetPersistencePath("")},
+		"codec":            {cache.SetEnablePersistence("invalid"), cache.WithPersistenceCodec(nil)},
+		"sizer":            {cache.WithSizer(func(value string) int64 { return 0 })},
+	}
+	for name, opts := range invalid {
+		_, err := cache.NewMapCache[int](opts...)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		_, err = cache.NewShardedMapCache[int](2, opts...)
+		if err == nil {
+			t.Errorf("%s: expected an error from the sharded cache", name)
+		}
+	}
+	_, err := cache.NewMapCache[int](cache.WithMaxEntries(0), cache.WithMaxBytes(0), cache.SetExpirationTime(cache.DefaultExpiration))
+	a.Equal(nil, err)
+}
+
+func TestClone(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	path := t.TempDir()
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.SetExpirationTime(time.Minute), cache.SetEnablePersistence("clone"), cache.SetPersistencePath(path))
+	a.Equal(nil, err)
+	defer c.Close()
+	c.Set("1", 1)
+	c.SetWithTTL("2", 2, time.Second)
+	clock.Advance(time.Second * 2)
+
+	clone, err := c.Clone()
+	a.Equal(nil, err)
+	defer clone.Close()
+	a.Equal(map[string]int{"1": 1}, clone.Items())
+	ttl, ok := clone.TTL("1")
+	a.Equal(true, ok)
+	a.Equal(time.Minute-time.Second*2, ttl)
+	a.Equal(false, clone.Flush() == nil)
+
+	clone.Set("1", 10)
+	clone.Set("3", 3)
+	clone.Delete("1")
+	a.Equal(map[string]int{"1": 1}, c.Items())
+	a.Equal(map[string]int{"3": 3}, clone.Items())
+	a.Equal(nil, clone.StopGc())
+
+	s, err := cache.NewShardedMapCache[int](4)
+	a.Equal(nil, err)
+	s.Set("1", 1)
+	sc, err := s.Clone()
+	a.Equal(nil, err)
+	sc.Set("2", 2)
+	a.Equal(map[string]int{"1": 1}, s.Items())
+	a.Equal(map[string]int{"1": 1, "2": 2}, sc.Items())
+}
+
+func TestGcInterval(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithGcInterval(0))
+	a.Equal(false, err == nil)
+	_, err = cache.NewMapCache[int](cache.WithGcInterval(-time.Second))
+	a.Equal(false, err == nil)
+
+	c, err := cache.NewMapCache[int](cache.WithGcInterval(time.Millisecond*5), cache.WithStats())
+	a.Equal(nil, err)
+	c.SetWithTTL("1", 1, time.Millisecond)
+	c.Set("2", 2)
+	time.Sleep(time.Millisecond * 50)
+	a.Equal(int64(1), c.Stats().Evictions)
+	a.Equal(nil, c.Close())
+
+	// SetGcInterval does not start gc when the data never expires by default, WithGcInterval does
+	c, err = cache.NewMapCache[int](cache.SetGcInterval(time.Millisecond * 5))
+	a.Equal(nil, err)
+	a.Equal(nil, c.StartGc())
+	a.Equal(nil, c.Close())
+	c, err = cache.NewMapCache[int](cache.WithGcInterval(time.Millisecond * 5))
+	a.Equal(nil, err)
+	a.Equal(false, c.StartGc() == nil)
+	a.Equal(nil, c.Close())
+
+	// the gc interval follows a short expiration time
+	c, err = cache.NewMapCache[int](cache.SetExpirationTime(time.Millisecond*5), cache.WithStats())
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	time.Sleep(time.Millisecond * 50)
+	a.Equal(int64(1), c.Stats().Evictions)
+	a.Equal(nil, c.Close())
+}
+
+func TestGetOrComputeCtx(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+
+	var count int32
+	fn := func(ctx context.Context) (int, error) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(time.Millisecond * 50)
+		return 1, nil
+	}
+	var wg sync.WaitGroup
+	var cancelled int32
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			if i%10 == 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Millisecond*10)
+				defer cancel()
+			}
+			value, err := c.GetOrComputeCtx(ctx, "1", fn)
+			if errors.Is(err, context.DeadlineExceeded) {
+				atomic.AddInt32(&cancelled, 1)
+				return
+			}
+			if err != nil || value != 1 {
+				t.Error("unexpected result", value, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	a.Equal(int32(1), atomic.LoadInt32(&count))
+	a.Equal(int32(10), atomic.LoadInt32(&cancelled))
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+
+	_, err = c.GetOrComputeCtx(context.Background(), "2", func(ctx context.Context) (int, error) {
+		return 0, errors.New("compute failed")
+	})
+	a.Equal(false, err == nil)
+	_, ok = c.Get("2")
+	a.Equal(false, ok)
+
+	// a computation does not join the load of the same key in flight
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loading, err := cache.NewMapCache[int](cache.WithLoader(func(key string) (int, time.Duration, error) {
+		close(started)
+		<-release
+		return 1, 0, nil
+	}))
+	a.Equal(nil, err)
+	loaded := make(chan int, 1)
+	go func() {
+		value, _ := loading.GetLoad("1")
+		loaded <- value
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	value, err = loading.GetOrComputeCtx(ctx, "1", func(ctx context.Context) (int, error) {
+		return 2, nil
+	})
+	a.Equal(nil, err)
+	a.Equal(2, value)
+	close(release)
+	a.Equal(1, <-loaded)
+}
+
+func TestLoader(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithLoader(func(key int) (int, time.Duration, error) { return 0, 0, nil }))
+	a.Equal(false, err == nil)
+	plain, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	_, err = plain.GetLoad("1")
+	a.Equal(false, err == nil)
+
+	var calls int64
+	failed := errors.New("not found")
+	c, err := cache.NewMapCache[int](cache.WithLoader(func(key string) (int, time.Duration, error) {
+		atomic.AddInt64(&calls, 1)
+		time.Sleep(time.Millisecond * 10)
+		if key == "missing" {
+			return 0, 0, failed
+		}
+		n, err := strconv.Atoi(key)
+		return n, time.Millisecond * 30, err
+	}))
+	a.Equal(nil, err)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := c.GetLoad("1")
+			a.Equal(nil, err)
+			a.Equal(1, value)
+		}()
+	}
+	wg.Wait()
+	a.Equal(int64(1), atomic.LoadInt64(&calls))
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	a.Equal(int64(1), atomic.LoadInt64(&calls))
+	ttl, ok := c.TTL("1")
+	a.Equal(true, ok)
+	a.Equal(true, ttl > 0 && ttl <= time.Millisecond*30)
+
+	// the data is loaded again after it expires
+	time.Sleep(time.Millisecond * 40)
+	value, ok = c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	a.Equal(int64(2), atomic.LoadInt64(&calls))
+
+	// errors are returned and not cached
+	_, err = c.GetLoad("missing")
+	a.Equal(failed, err)
+	_, ok = c.Get("missing")
+	a.Equal(false, ok)
+	a.Equal(int64(4), atomic.LoadInt64(&calls))
+	a.Equal(1, c.Len())
+}
+
+func TestGetManyCtx(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.WithLoader(func(key string) (int, time.Duration, error) {
+		n, err := strconv.Atoi(key)
+		if err != nil {
+			return 0, 0, err
+		}
+		time.Sleep(time.Millisecond * time.Duration(n))
+		return n, 0, nil
+	}))
+	a.Equal(nil, err)
+	defer c.Close()
+	c.Set("cached", -1)
+	values, err := c.GetManyCtx(context.Background(), []string{"cached", "1", "2", "invalid"})
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"cached": -1, "1": 1, "2": 2}, values)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	start := time.Now()
+	values, err = c.GetManyCtx(ctx, []string{"cached", "10", "200"})
+	a.Equal(context.DeadlineExceeded, err)
+	a.Equal(map[string]int{"cached": -1, "10": 10}, values)
+	a.Equal(true, time.Since(start) < time.Millisecond*150)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	values, err = c.GetManyCtx(ctx, []string{"cached"})
+	a.Equal(context.Canceled, err)
+	a.Equal(0, len(values))
+
+	// the shards load in parallel: each load waits until the load of the other shard has started
+	var started sync.WaitGroup
+	started.Add(2)
+	s, err := cache.NewShardedMapCache[int](2,
+		cache.WithShardHasher(func(key string) uint64 { return uint64(key[0]) }),
+		cache.WithLoader(func(key string) (int, time.Duration, error) {
+			started.Done()
+			started.Wait()
+			return int(key[0]), 0, nil
+		}))
+	a.Equal(nil, err)
+	defer s.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	values, err = s.GetManyCtx(ctx, []string{"a", "b"})
+	a.Equal(nil, err)
+	a.Equal(map[string]int{"a": 'a', "b": 'b'}, values)
+}
+
+func TestKeyMapCache(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewKeyMapCache[int, string](cache.WithMaxEntries(2))
+	a.Equal(nil, err)
+	c.Set(1, "1")
+	c.Set(2, "2")
+	c.Set(3, "3")
+	_, ok := c.Get(1)
+	a.Equal(false, ok)
+	value, ok := c.Get(2)
+	a.Equal(true, ok)
+	a.Equal("2", value)
+	a.Equal(map[int]string{2: "2", 3: "3"}, c.Items())
+
+	type point struct {
+		X, Y int
+	}
+	var evicted []point
+	p, err := cache.NewKeyMapCache[point, int](cache.WithOnEvicted(func(key point, value int, reason cache.EvictionReason) {
+		evicted = append(evicted, key)
+	}))
+	a.Equal(nil, err)
+	p.Set(point{1, 2}, 3)
+	a.Equal(nil, p.Add(point{2, 3}, 5))
+	a.Equal(false, p.Add(point{1, 2}, 4) == nil)
+	value1, ok := p.Get(point{1, 2})
+	a.Equal(true, ok)
+	a.Equal(3, value1)
+	p.Delete(point{1, 2})
+	a.Equal([]point{{1, 2}}, evicted)
+	a.Equal([]point{{2, 3}}, p.Keys())
+}
+
+func TestKeyMapCachePersistence(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewKeyMapCache[int, string](cache.WithPersistenceCodec(cache.JSONCodec{}))
+	a.Equal(nil, err)
+	c.Set(1, "1")
+	var buf bytes.Buffer
+	a.Equal(nil, c.Save(&buf))
+	c, err = cache.NewKeyMapCache[int, string](cache.WithPersistenceCodec(cache.JSONCodec{}))
+	a.Equal(nil, err)
+	a.Equal(nil, c.Load(&buf))
+	a.Equal(map[int]string{1: "1"}, c.Items())
+
+	type point struct {
+		X, Y int
+	}
+	path := t.TempDir()
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("point"), cache.SetPersistencePath(path)}
+	p, err := cache.NewKeyMapCache[point, int](opts...)
+	a.Equal(nil, err)
+	p.Set(point{1, 2}, 3)
+	a.Equal(nil, p.Close())
+	p, err = cache.NewKeyMapCache[point, int](opts...)
+	a.Equal(nil, err)
+	a.Equal(map[point]int{{1, 2}: 3}, p.Items())
+	a.Equal(nil, p.Close())
+}
+
+func TestMaxBytes(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[[]byte](cache.WithMaxBytes(100), cache.WithSizer(func(value []byte) int64 {
+		return int64(len(value))
+	}))
+	a.Equal(nil, err)
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), make([]byte, 10))
+	}
+	a.Equal(10, c.Len())
+	_, ok := c.Get("0")
+	a.Equal(true, ok)
+	// a large item evicts the least recently used data until the cache is under the limit
+	c.Set("large", make([]byte, 50))
+	a.Equal(6, c.Len())
+	_, ok = c.Get("0")
+	a.Equal(true, ok)
+	for i := 1; i <= 5; i++ {
+		_, ok = c.Get(strconv.Itoa(i))
+		a.Equal(false, ok)
+	}
+	// growing existing data also evicts
+	c.Set("0", make([]byte, 30))
+	a.Equal(4, c.Len())
+	_, ok = c.Get("large")
+	a.Equal(true, ok)
+	// data larger than the limit is not kept
+	c.Set("huge", make([]byte, 200))
+	a.Equal(0, c.Len())
+
+	// without a sizer, each data counts as 1
+	n, err := cache.NewMapCache[int](cache.WithMaxBytes(2))
+	a.Equal(nil, err)
+	n.Set("1", 1)
+	n.Set("2", 2)
+	n.Set("3", 3)
+	a.Equal(2, n.Len())
+
+	_, err = cache.NewMapCache[int](cache.WithSizer(func(value string) int64 { return 1 }))
+	a.Equal(false, err == nil)
+}
+
+func TestCost(t *testing.T) {
+	a := assert.NewAssert(t)
+	_, err := cache.NewMapCache[int](cache.WithCost(func(value string) int64 { return 0 }))
+	a.Equal(false, err == nil)
+
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(5), cache.WithCost(func(value int) int64 {
+		return int64(value)
+	}))
+	a.Equal(nil, err)
+	c.Set("expensive", 100)
+	c.Set("costly", 50)
+	for i := 0; i < 20; i++ {
+		c.Set(strconv.Itoa(i), 1)
+	}
+	a.Equal(5, c.Len())
+	_, ok := c.Get("expensive")
+	a.Equal(true, ok)
+	_, ok = c.Get("costly")
+	a.Equal(true, ok)
+	// the least recently used data among the data with the same cost is evicted
+	keys := slice.Filter(c.Keys(), func(k string) bool {
+		return k != "expensive" && k != "costly"
+	})
+	slice.Sort(keys, func(a, b string) bool { return a < b })
+	a.Equal([]string{"17", "18", "19"}, keys)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	a := assert.NewAssert(t)
+	eq := func(a, b []int) bool {
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	}
+	c, err := cache.NewMapCache[[]int]()
+	a.Equal(nil, err)
+	c.SetWithTTL("1", []int{1}, time.Hour)
+	a.Equal(true, c.CompareAndSwap("1", []int{1}, []int{2}, eq))
+	value, _ := c.Get("1")
+	a.Equal([]int{2}, value)
+	ttl, _ := c.TTL("1")
+	a.Equal(true, ttl > time.Minute)
+	a.Equal(false, c.CompareAndSwap("1", []int{1}, []int{3}, eq))
+	value, _ = c.Get("1")
+	a.Equal([]int{2}, value)
+	a.Equal(false, c.CompareAndSwap("2", nil, []int{3}, eq))
+	_, ok := c.Get("2")
+	a.Equal(false, ok)
+
+	a.Equal(false, c.CompareAndDelete("1", []int{1}, eq))
+	a.Equal(false, c.CompareAndDelete("2", []int{1}, eq))
+	a.Equal(true, c.CompareAndDelete("1", []int{2}, eq))
+	_, ok = c.Get("1")
+	a.Equal(false, ok)
+
+	// the swap is rejected if the new data does not fit
+	c, err = cache.NewMapCache[[]int](cache.WithMaxBytes(3), cache.WithFullPolicy(cache.RejectNew),
+		cache.WithSizer(func(value []int) int64 { return int64(len(value)) }))
+	a.Equal(nil, err)
+	c.Set("1", []int{1})
+	a.Equal(false, c.CompareAndSwap("1", []int{1}, []int{1, 2, 3, 4}, eq))
+	value, _ = c.Get("1")
+	a.Equal([]int{1}, value)
+	a.Equal(true, c.CompareAndSwap("1", []int{1}, []int{1, 2, 3}, eq))
+}
+
+func TestPrefix(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.SetMany(map[string]int{"user:1:profile": 1, "user:1:name": 2, "user:2:profile": 3, "order:1": 4})
+	c.SetWithTTL("user:1:expired", 5, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+
+	keys := c.KeysWithPrefix("user:1:")
+	slice.Sort(keys, func(a, b string) bool { return a < b })
+	a.Equal([]string{"user:1:name", "user:1:profile"}, keys)
+	a.Equal(4, len(c.KeysWithPrefix("")))
+	a.Equal([]string{}, c.KeysWithPrefix("none"))
+
+	a.Equal(0, c.DeleteByPrefix("none"))
+	a.Equal(2, c.DeleteByPrefix("user:1:"))
+	a.Equal(2, c.Len())
+	a.Equal(2, c.DeleteByPrefix(""))
+	a.Equal(0, c.Len())
+
+	s, err := cache.NewShardedMapCache[int](4)
+	a.Equal(nil, err)
+	s.SetMany(map[string]int{"user:1": 1, "user:2": 2, "order:1": 3})
+	a.Equal(2, len(s.KeysWithPrefix("user:")))
+	a.Equal(2, s.DeleteByPrefix("user:"))
+	a.Equal([]string{"order:1"}, s.Keys())
+}
+
+func TestCopier(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[[]int](cache.WithCopier(func(value []int) []int {
+		return append([]int(nil), value...)
+	}))
+	a.Equal(nil, err)
+	value := []int{1, 2}
+	c.Set("1", value)
+	value[0] = 3
+	res, _ := c.Get("1")
+	a.Equal([]int{1, 2}, res)
+	res[0] = 3
+	res, _ = c.Get("1")
+	a.Equal([]int{1, 2}, res)
+	c.Items()["1"][0] = 3
+	res, _ = c.Peek("1")
+	a.Equal([]int{1, 2}, res)
+
+	// without a copier the data is shared by reference
+	s, err := cache.NewMapCache[[]int]()
+	a.Equal(nil, err)
+	s.Set("1", value)
+	res, _ = s.Get("1")
+	res[0] = 4
+	a.Equal(4, value[0])
+
+	_, err = cache.NewMapCache[[]int](cache.WithCopier(func(value string) string { return value }))
+	a.Equal(false, err == nil)
+}
+
+func TestMustGet(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.SetWithTTL("2", 2, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+
+	value, err := c.MustGet("1")
+	a.Equal(nil, err)
+	a.Equal(1, value)
+	_, err = c.MustGet("2")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	_, err = c.MustGet("3")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	a.Equal(true, errors.Is(c.Replace("3", 3), cache.ErrKeyNotFound))
+	_, err = c.GetLoad("3")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+
+	n, err := cache.NewNumberMapCache[int]()
+	a.Equal(nil, err)
+	_, err = n.Increment("1", 1)
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+}
+
+func TestAdaptiveGc(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.WithAdaptiveGc(), cache.WithGcInterval(time.Hour), cache.WithStats())
+	a.Equal(nil, err)
+	defer c.Close()
+	c.Set("never", 0)
+	c.SetWithTTL("1", 1, time.Millisecond*20)
+	c.SetWithTTL("2", 2, time.Millisecond*20)
+	c.SetWithTTL("2", 2, time.Hour)
+	c.SetWithTTL("3", 3, time.Hour)
+	a.Equal(true, c.Touch("3", time.Millisecond*40))
+	time.Sleep(time.Millisecond * 100)
+	_, err = c.IsExpired("1")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	_, err = c.IsExpired("3")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	a.Equal(int64(2), c.Stats().Evictions)
+	a.Equal(2, c.Len())
+
+	// without the adaptive gc, expired data lingers until the next gc interval
+	s, err := cache.NewMapCache[int](cache.WithGcInterval(time.Hour))
+	a.Equal(nil, err)
+	defer s.Close()
+	s.SetWithTTL("1", 1, time.Millisecond*20)
+	time.Sleep(time.Millisecond * 50)
+	expired, err := s.IsExpired("1")
+	a.Equal(nil, err)
+	a.Equal(true, expired)
+}
+
+func TestReadOnly(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	var view cache.ReadOnlyMap[int] = c.ReadOnly()
+	value, ok := view.Get("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	c.Set("2", 2)
+	a.Equal(2, view.Len())
+
+	// the view can not be converted back to a cache that can be changed
+	_, ok = view.(interface{ Set(key string, value int) })
+	a.Equal(false, ok)
+	_, ok = view.(interface{ Delete(key string) (int, bool) })
+	a.Equal(false, ok)
+	_, ok = view.(cache.MapInterface[int])
+	a.Equal(false, ok)
+
+	s, err := cache.NewShardedMapCache[int](2)
+	a.Equal(nil, err)
+	s.Set("1", 1)
+	a.Equal([]string{"1"}, s.ReadOnly().Keys())
+}
+
+func TestWithContext(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("context"), cache.SetPersistencePath(path)}
+	goroutines := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := cache.NewMapCache[int](append(opts, cache.WithContext(ctx), cache.WithGcInterval(time.Hour))...)
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	cancel()
+
+	// gc, persistence and the watcher of the context exit, and the data is persisted one last time
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	a.Equal(true, runtime.NumGoroutine() <= goroutines)
+	a.Equal(false, c.StartGc() == nil)
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	a.Equal(nil, c.Close())
+
+	// closing the cache stops watching the context
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	c, err = cache.NewMapCache[int](cache.WithContext(ctx))
+	a.Equal(nil, err)
+	a.Equal(nil, c.Close())
+	deadline = time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	a.Equal(true, runtime.NumGoroutine() <= goroutines)
+}
+
+func TestSetManyWithTTL(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.SetExpirationTime(time.Minute))
+	a.Equal(nil, err)
+	defer c.Close()
+	entries := map[string]cache.ItemSpec[int]{
+		"second":  {Value: 1, TTL: time.Second},
+		"hour":    {Value: 2, TTL: time.Hour},
+		"default": {Value: 3},
+		"never":   {Value: 4, TTL: -1},
+	}
+	c.SetManyWithTTL(entries)
+	a.Equal(4, c.Len())
+	clock.Advance(time.Second * 2)
+	_, ok := c.Get("second")
+	a.Equal(false, ok)
+	a.Equal(3, c.Len())
+	clock.Advance(time.Minute)
+	_, ok = c.Get("default")
+	a.Equal(false, ok)
+	clock.Advance(time.Hour)
+	a.Equal([]string{"never"}, c.Keys())
+
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	s.SetManyWithTTL(entries)
+	clock.Advance(time.Second * 2)
+	a.Equal(3, s.Len())
+}
+
+func TestAddExpired(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	c.SetWithTTL("1", 1, time.Millisecond)
+	a.Equal(false, c.Add("1", 2) == nil)
+	clock.Advance(time.Millisecond * 2)
+	expired, err := c.IsExpired("1")
+	a.Equal(nil, err)
+	a.Equal(true, expired)
+	a.Equal(nil, c.Add("1", 2))
+	value, ok := c.Get("1")
+	a.Equal(true, ok)
+	a.Equal(2, value)
+	a.Equal(false, c.AddWithTTL("1", 3, time.Hour) == nil)
+}
+
+func TestFullPolicy(t *testing.T) {
+	a := assert.NewAssert(t)
+	sorted := func(keys []string) []string {
+		slice.Sort(keys, func(a, b string) bool { return a < b })
+		return keys
+	}
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(2), cache.WithFullPolicy(cache.RejectNew))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	a.Equal(nil, c.Add("2", 2))
+	c.Set("3", 3)
+	a.Equal(true, errors.Is(c.Add("4", 4), cache.ErrCacheFull))
+	a.Equal(false, c.SetIfAbsent("5", 5, 0))
+	_, ok := c.Get("3")
+	a.Equal(false, ok)
+	// overwriting data is not rejected
+	c.Set("1", 10)
+	value, _ := c.Get("1")
+	a.Equal(10, value)
+	a.Equal(nil, c.Replace("2", 20))
+	c.Delete("2")
+	a.Equal(nil, c.Add("4", 4))
+	a.Equal([]string{"1", "4"}, sorted(c.Keys()))
+
+	s, err := cache.NewMapCache[string](cache.WithMaxBytes(4), cache.WithFullPolicy(cache.RejectNew),
+		cache.WithSizer(func(value string) int64 { return int64(len(value)) }))
+	a.Equal(nil, err)
+	s.Set("1", "ab")
+	s.Set("2", "cd")
+	s.Set("3", "e")
+	a.Equal(true, errors.Is(s.Replace("1", "abc"), cache.ErrCacheFull))
+	str, _ := s.Get("1")
+	a.Equal("ab", str)
+	a.Equal(2, s.Len())
+
+	// the default policy evicts the least recently used data
+	c, err = cache.NewMapCache[int](cache.WithMaxEntries(2), cache.WithFullPolicy(cache.EvictLRU))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	a.Equal(nil, c.Add("3", 3))
+	a.Equal([]string{"2", "3"}, sorted(c.Keys()))
+}
+
+func TestFIFO(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(3), cache.WithEvictionPolicy(cache.FIFO))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Set("3", 3)
+	// reads and overwrites do not change the order
+	c.Get("1")
+	c.Set("1", 10)
+	c.Set("4", 4)
+	_, ok := c.Get("1")
+	a.Equal(false, ok)
+	c.Get("2")
+	c.Set("5", 5)
+	_, ok = c.Get("2")
+	a.Equal(false, ok)
+	a.Equal(3, c.Len())
+	for _, key := range []string{"3", "4", "5"} {
+		_, ok = c.Get(key)
+		a.Equal(true, ok)
+	}
+}
+
+// firstInPolicy always evicts the data inserted first, and records the calls of the cache
+type firstInPolicy struct {
+	keys  []string
+	calls []string
+}
+
+func (p *firstInPolicy) RecordInsert(key any) {
+	p.keys = append(p.keys, key.(string))
+	p.calls = append(p.calls, "insert "+key.(string))
+}
+
+func (p *firstInPolicy) RecordAccess(key any) {
+	p.calls = append(p.calls, "access "+key.(string))
+}
+
+func (p *firstInPolicy) RecordRemove(key any) {
+	for i, k := range p.keys {
+		if k == key {
+			p.keys = append(p.keys[:i], p.keys[i+1:]...)
+			break
+		}
+	}
+	p.calls = append(p.calls, "remove "+key.(string))
+}
+
+func (p *firstInPolicy) Reset() {
+	p.keys = nil
+	p.calls = append(p.calls, "reset")
+}
+
+func (p *firstInPolicy) Evict() (any, bool) {
+	p.calls = append(p.calls, "evict")
+	if len(p.keys) == 0 {
+		return nil, false
+	}
+	return p.keys[0], true
+}
+
+// countingPolicy counts the evictions of the policy it wraps
+type countingPolicy struct {
+	cache.EvictionPolicy
+	evictions int
+}
+
+func (p *countingPolicy) Evict() (any, bool) {
+	p.evictions++
+	return p.EvictionPolicy.Evict()
+}
+
+// stalePolicy chooses keys the cache does not hold before it chooses the keys of the cache
+type stalePolicy struct {
+	firstInPolicy
+	stale []any
+}
+
+func (p *stalePolicy) RecordRemove(key any) {
+	for i, k := range p.stale {
+		if k == key {
+			p.stale = append(p.stale[:i], p.stale[i+1:]...)
+			return
+		}
+	}
+	p.firstInPolicy.RecordRemove(key)
+}
+
+func (p *stalePolicy) Evict() (any, bool) {
+	if len(p.stale) > 0 {
+		return p.stale[0], true
+	}
+	return p.firstInPolicy.Evict()
+}
+
+// lostPolicy never chooses any data
+type lostPolicy struct {
+	firstInPolicy
+}
+
+func (p *lostPolicy) Evict() (any, bool) {
+	return nil, false
+}
+
+func TestMisbehavingEvictionPolicy(t *testing.T) {
+	a := assert.NewAssert(t)
+	// stale keys and keys of another type are skipped
+	stale := &stalePolicy{stale: []any{"gone", 1}}
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(2), cache.WithEvictionPolicy(stale))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Set("3", 3)
+	a.Equal([]string{"2", "3"}, sortKeys(c.Keys()))
+	a.Equal(0, len(stale.stale))
+
+	// the cache does not stay over capacity when the policy chooses nothing
+	c, err = cache.NewMapCache[int](cache.WithMaxEntries(2), cache.WithEvictionPolicy(&lostPolicy{}))
+	a.Equal(nil, err)
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+		a.Equal(true, c.Len() <= 2)
+	}
+	a.Equal(2, c.Len())
+}
+
+func TestCustomEvictionPolicy(t *testing.T) {
+	a := assert.NewAssert(t)
+	policy := &firstInPolicy{}
+	c, err := cache.NewMapCache[int](cache.WithMaxEntries(2), cache.WithEvictionPolicy(policy))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Get("1")
+	c.Set("2", 20)
+	c.Set("3", 3)
+	c.Delete("2")
+	a.Equal([]string{
+		"insert 1", "insert 2", "access 1", "access 2",
+		"insert 3", "evict", "remove 1", "remove 2",
+	}, policy.calls)
+	a.Equal([]string{"3"}, c.Keys())
+	a.Equal(cache.EvictionPolicy(policy), c.Config().EvictionPolicy)
+
+	c.Clear()
+	a.Equal(0, len(policy.keys))
+	a.Equal("reset", policy.calls[len(policy.calls)-1])
+
+	// the policy is not used if the number and size of data are unlimited
+	unused := &firstInPolicy{}
+	c, err = cache.NewMapCache[int](cache.WithEvictionPolicy(unused))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	a.Equal(0, len(unused.calls))
+
+	// the built-in policies can be wrapped
+	counting := &countingPolicy{EvictionPolicy: &cache.LRUPolicy{}}
+	c, err = cache.NewMapCache[int](cache.WithMaxEntries(2), cache.WithEvictionPolicy(counting))
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Get("1")
+	c.Set("3", 3)
+	a.Equal([]string{"1", "3"}, sortKeys(c.Keys()))
+	a.Equal(1, counting.evictions)
+
+	_, err = cache.NewShardedMapCache[int](4, cache.WithMaxEntries(2), cache.WithEvictionPolicy(&firstInPolicy{}))
+	a.Equal(false, err == nil)
+	_, err = cache.NewMapCache[int](cache.WithMaxEntries(2), cache.WithEvictionPolicy(&firstInPolicy{}),
+		cache.WithCost(func(value int) int64 { return int64(value) }))
+	a.Equal(false, err == nil)
+}
+
+func TestIsGcRunning(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	a.Equal(false, c.IsGcRunning())
+	a.Equal(nil, c.StartGc())
+	a.Equal(true, c.IsGcRunning())
+	a.Equal(nil, c.StopGc())
+	a.Equal(false, c.IsGcRunning())
+
+	s, err := cache.NewShardedMapCache[int](2, cache.SetExpirationTime(time.Minute))
+	a.Equal(nil, err)
+	a.Equal(true, s.IsGcRunning())
+	a.Equal(nil, s.Close())
+	a.Equal(false, s.IsGcRunning())
+}
+
+func TestGetAndDeleteMany(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.Set(keys[i], i)
+	}
+	c.SetWithTTL("expired", 0, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+	a.Equal(map[string]int{}, c.GetAndDeleteMany([]string{"expired", "missing"}))
+
+	// concurrent callers partition the keys without duplicates
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	popped := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for j := 0; j < len(keys); j += 10 {
+				start := (j + offset*100) % len(keys)
+				for key := range c.GetAndDeleteMany(keys[start : start+10]) {
+					mu.Lock()
+					popped[key]++
+					mu.Unlock()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	a.Equal(len(keys), len(popped))
+	for _, count := range popped {
+		a.Equal(1, count)
+	}
+	a.Equal(0, c.Len())
+}
+
+func TestAutoGcIdempotent(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Minute))
+	a.Equal(nil, err)
+	a.Equal(false, c.StartGc() == nil)
+	a.Equal(nil, c.Close())
+
+	c, err = cache.NewMapCache[int](cache.WithAutoGcIdempotent())
+	a.Equal(nil, err)
+	defer c.Close()
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		a.Equal(nil, c.StartGc())
+	}
+	a.Equal(true, c.IsGcRunning())
+	a.Equal(true, runtime.NumGoroutine() <= goroutines+1)
+}
+
+func TestPersistenceSkipExpired(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	start := time.Now().UnixNano() / 1e3
+	clock := &fakeClock{now: start}
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("expired"), cache.SetPersistencePath(path), cache.WithClock(clock)}
+
+	// expired data is not saved, even if the file is loaded before it would expire
+	c, err := cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	c.SetWithTTL("short", 1, time.Second)
+	c.SetWithTTL("long", 2, time.Hour)
+	clock.Advance(time.Second * 2)
+	a.Equal(nil, c.Close())
+	atomic.StoreInt64(&clock.now, start)
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	_, err = c.IsExpired("short")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	a.Equal(1, c.Len())
+
+	// data that expires while the cache is not running is dropped on load
+	c.SetWithTTL("short", 1, time.Second)
+	a.Equal(nil, c.Close())
+	clock.Advance(time.Second * 2)
+	c, err = cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	_, err = c.IsExpired("short")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	a.Equal([]string{"long"}, c.Keys())
+	a.Equal(nil, c.Close())
+}
+
+func TestExpiryInfo(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	c.SetWithTTL("1", 1, time.Minute)
+	c.Set("never", 2)
+
+	info, err := c.ExpiryInfo("1")
+	a.Equal(nil, err)
+	a.Equal(cache.ExpiryStatus{
+		Exists:    true,
+		ExpiresAt: time.UnixMicro(clock.Now() + time.Minute.Microseconds()),
+		Remaining: time.Minute,
+	}, info)
+
+	clock.Advance(time.Minute * 2)
+	info, err = c.ExpiryInfo("1")
+	a.Equal(nil, err)
+	a.Equal(true, info.Exists)
+	a.Equal(true, info.Expired)
+	a.Equal(-time.Minute, info.Remaining)
+
+	info, err = c.ExpiryInfo("never")
+	a.Equal(nil, err)
+	a.Equal(cache.ExpiryStatus{Exists: true, Remaining: cache.DefaultExpiration}, info)
+	a.Equal(true, info.ExpiresAt.IsZero())
+
+	info, err = c.ExpiryInfo("missing")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	a.Equal(false, info.Exists)
+}
+
+func TestDeleteWhere(t *testing.T) {
+	a := assert.NewAssert(t)
+	var evicted []string
+	c, err := cache.NewMapCache[int](cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+		a.Equal(cache.ReasonDeleted, reason)
+		evicted = append(evicted, key)
+	}))
+	a.Equal(nil, err)
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.SetWithTTL("expired", 100, time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+
+	even := func(key string, value int) bool { return value%2 == 0 }
+	a.Equal(5, c.DeleteWhere(even))
+	a.Equal(5, c.Len())
+	c.Range(func(key string, value int) bool {
+		a.Equal(1, value%2)
+		return true
+	})
+	slice.Sort(evicted, func(a, b string) bool { return a < b })
+	a.Equal([]string{"0", "2", "4", "6", "8"}, evicted)
+	a.Equal(0, c.DeleteWhere(even))
+
+	s, err := cache.NewShardedMapCache[int](4)
+	a.Equal(nil, err)
+	s.SetMany(map[string]int{"1": 1, "2": 2, "3": 3, "4": 4})
+	a.Equal(2, s.DeleteWhere(even))
+	a.Equal(2, s.Len())
+}
+
+func TestLazyExpiration(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithLazyExpiration(), cache.SetExpirationTime(time.Second),
+		cache.WithClock(clock), cache.WithStats())
+	a.Equal(nil, err)
+	a.Equal(false, c.IsGcRunning())
+	c.Set("1", 1)
+	c.Set("2", 2)
+	clock.Advance(time.Second * 2)
+	a.Equal(0, c.Len())
+	expired, err := c.IsExpired("1")
+	a.Equal(nil, err)
+	a.Equal(true, expired)
+
+	// reading expired data removes it from the map
+	_, ok := c.Get("1")
+	a.Equal(false, ok)
+	_, err = c.IsExpired("1")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+	a.Equal(1, c.Stats().Entries)
+	a.Equal(int64(1), c.Stats().Evictions)
+}
+
+func TestShardHasher(t *testing.T) {
+	a := assert.NewAssert(t)
+	// keys with the same prefix go to the same shard
+	hasher := func(key string) uint64 {
+		if strings.HasPrefix(key, "user:") {
+			return 0
+		}
+		return 1
+	}
+	c, err := cache.NewShardedMapCache[int](2, cache.WithShardHasher(hasher), cache.WithMaxEntries(2))
+	a.Equal(nil, err)
+	// each shard holds 1 data, so the keys in the same shard evict each other
+	c.Set("user:1", 1)
+	c.Set("order:1", 1)
+	c.Set("user:2", 2)
+	a.Equal(2, c.Len())
+	_, ok := c.Get("user:1")
+	a.Equal(false, ok)
+	_, ok = c.Get("order:1")
+	a.Equal(true, ok)
+	value, ok := c.Get("user:2")
+	a.Equal(true, ok)
+	a.Equal(2, value)
+
+	clone, err := c.Clone()
+	a.Equal(nil, err)
+	value, ok = clone.Get("user:2")
+	a.Equal(true, ok)
+	a.Equal(2, value)
+	clone.Set("user:3", 3)
+	_, ok = clone.Get("user:2")
+	a.Equal(false, ok)
+}
+
+func TestReplaceKeepTTL(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	defer c.Close()
+	c.SetWithTTL("1", 1, time.Minute)
+	_, before, _ := c.GetWithExpiration("1")
+	clock.Advance(time.Second * 30)
+	a.Equal(nil, c.ReplaceKeepTTL("1", 2))
+	value, after, ok := c.GetWithExpiration("1")
+	a.Equal(true, ok)
+	a.Equal(2, value)
+	a.Equal(before, after)
+	// Replace resets the expiration time
+	a.Equal(nil, c.Replace("1", 3))
+	_, after, _ = c.GetWithExpiration("1")
+	a.Equal(time.UnixMicro(clock.Now()+time.Hour.Microseconds()), after)
+
+	a.Equal(true, errors.Is(c.ReplaceKeepTTL("missing", 1), cache.ErrKeyNotFound))
+	c.SetWithTTL("never", 1, -1)
+	a.Equal(nil, c.ReplaceKeepTTL("never", 2))
+	ttl, _ := c.TTL("never")
+	a.Equal(cache.DefaultExpiration, ttl)
+}
+
+func TestPersistencePath(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	file := filepath.Join(path, "file")
+	a.Equal(nil, os.WriteFile(file, nil, 0644))
+	invalid := map[string][]cache.CreateOptionFunc{
+		"missing folder":   {cache.SetEnablePersistence("missing"), cache.SetPersistencePath(filepath.Join(path, "missing"))},
+		"not a folder":     {cache.SetEnablePersistence("file"), cache.SetPersistencePath(file)},
+		"can not create":   {cache.SetEnablePersistence("file"), cache.SetPersistencePath(filepath.Join(file, "sub")), cache.WithCreateDirs()},
+		"file is folder":   {cache.SetEnablePersistence("folder"), cache.SetPersistencePath(path)},
+		"wal not writable": {cache.SetEnablePersistence("wal"), cache.SetPersistencePath(path), cache.WithWAL(filepath.Join(file, "wal.log"))},
+	}
+	a.Equal(nil, os.Mkdir(filepath.Join(path, "folder"+cache.FileSUFFIX), 0755))
+	for name, opts := range invalid {
+		if _, err := cache.NewMapCache[int](opts...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// the missing folders are created
+	nested := filepath.Join(path, "a", "b")
+	c, err := cache.NewMapCache[int](cache.SetEnablePersistence("nested"), cache.SetPersistencePath(nested),
+		cache.WithWAL(filepath.Join(path, "c", "wal.log")), cache.WithCreateDirs())
+	a.Equal(nil, err)
+	c.Set("1", 1)
+	a.Equal(nil, c.Close())
+	_, err = os.Stat(filepath.Join(nested, "nested"+cache.FileSUFFIX))
+	a.Equal(nil, err)
+	_, err = os.Stat(filepath.Join(path, "c", "wal.log"))
+	a.Equal(nil, err)
+}
+
+func TestGetOrDefault(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[string]()
+	a.Equal(nil, err)
+	c.Set("present", "value")
+	c.SetWithTTL("expired", "value", time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+	a.Equal("value", c.GetOrDefault("present", "default"))
+	a.Equal("default", c.GetOrDefault("absent", "default"))
+	a.Equal("default", c.GetOrDefault("expired", "default"))
+}
+
+func TestApproxBytes(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[[]int](cache.WithSizer(func(value []int) int64 { return int64(len(value) * 8) }))
+	a.Equal(nil, err)
+	c.Set("1", []int{1, 2})
+	c.Set("2", []int{1, 2, 3})
+	a.Equal(int64(40), c.ApproxBytes())
+	c.Set("1", []int{1})
+	c.Delete("2")
+	a.Equal(int64(8), c.ApproxBytes())
+	c.Clear()
+	a.Equal(int64(0), c.ApproxBytes())
+
+	// without a sizer, the size is estimated from the type
+	s, err := cache.NewMapCache[string]()
+	a.Equal(nil, err)
+	s.Set("1", "abc")
+	s.Set("2", "de")
+	a.Equal(int64(5), s.ApproxBytes())
+	n, err := cache.NewShardedMapCache[int64](2)
+	a.Equal(nil, err)
+	n.SetMany(map[string]int64{"1": 1, "2": 2, "3": 3})
+	a.Equal(int64(24), n.ApproxBytes())
+	p, err := cache.NewMapCache[*int]()
+	a.Equal(nil, err)
+	a.Equal(int64(-1), p.ApproxBytes())
+}
+
+func TestTags(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	c.SetWithTags("profile:42", 1, "user:42", "profile")
+	c.SetWithTags("orders:42", 2, "user:42", "orders")
+	c.SetWithTags("profile:43", 3, "user:43", "profile")
+	c.SetWithTags("untagged", 4)
+
+	a.Equal(2, c.InvalidateTag("user:42"))
+	a.Equal([]string{"profile:43", "untagged"}, sortKeys(c.Keys()))
+	a.Equal(0, c.InvalidateTag("user:42"))
+	a.Equal(0, c.InvalidateTag("orders"))
+	a.Equal(1, c.InvalidateTag("profile"))
+
+	// setting the data again without tags removes its tags
+	c.SetWithTags("1", 1, "group")
+	c.Set("1", 1)
+	a.Equal(0, c.InvalidateTag("group"))
+	a.Equal(2, c.Len())
+
+	// data that expires is removed from its tags
+	c.SetWithTags("2", 2, "group")
+	a.Equal(true, c.Touch("2", time.Second))
+	clock.Advance(time.Second * 2)
+	a.Equal(1, c.DeleteExpired())
+	c.Set("2", 2)
+	a.Equal(0, c.InvalidateTag("group"))
+	_, ok := c.Get("2")
+	a.Equal(true, ok)
+
+	s, err := cache.NewShardedMapCache[int](4)
+	a.Equal(nil, err)
+	for i := 0; i < 10; i++ {
+		s.SetWithTags(strconv.Itoa(i), i, "all")
+	}
+	a.Equal(10, s.InvalidateTag("all"))
+	a.Equal(0, s.Len())
+}
+
+func sortKeys(keys []string) []string {
+	slice.Sort(keys, func(a, b string) bool { return a < b })
+	return keys
+}
+
+func TestOrderedByExpiry(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	now := clock.Now()
+	m, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{m, s} {
+		c.SetWithTTL("hour", 1, time.Hour)
+		c.Set("never", 2)
+		c.SetWithTTL("minute", 3, time.Minute)
+		c.SetWithTTL("second", 4, time.Second)
+		c.SetWithTTL("expired", 5, time.Microsecond)
+		c.SetWithTTL("forever", 6, -1)
+		clock.Advance(time.Microsecond * 2)
+		keys := c.OrderedByExpiry()
+		a.Equal(5, len(keys))
+		a.Equal([]cache.KeyExpiry[string]{
+			{Key: "second", ExpiresAt: time.UnixMicro(now + time.Second.Microseconds())},
+			{Key: "minute", ExpiresAt: time.UnixMicro(now + time.Minute.Microseconds())},
+			{Key: "hour", ExpiresAt: time.UnixMicro(now + time.Hour.Microseconds())},
+		}, keys[:3])
+		a.Equal(true, keys[3].ExpiresAt.IsZero())
+		a.Equal(true, keys[4].ExpiresAt.IsZero())
+		clock.Advance(-time.Microsecond * 2)
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	a := assert.NewAssert(t)
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewTieredCache[string](2, dir, cache.WithClock(clock))
+	a.Equal(nil, err)
+	c.Set("a", "1")
+	c.SetWithTTL("b", "2", time.Minute)
+	c.Set("c", "3")
+	c.Set("d", "4")
+	// a and b are moved to the cold tier
+	files, _ := os.ReadDir(dir)
+	a.Equal(2, len(files))
+	a.Equal(4, c.Len())
+	a.Equal([]string{"a", "b", "c", "d"}, sortKeys(c.Keys()))
+	value, ok := c.Get("a")
+	a.Equal(true, ok)
+	a.Equal("1", value)
+	// a is promoted to the hot tier, c is moved to the cold tier
+	files, _ = os.ReadDir(dir)
+	a.Equal(2, len(files))
+	_, err = os.Stat(filepath.Join(dir, "YQ.cold"))
+	a.Equal(true, os.IsNotExist(err))
+	ttl, ok := c.TTL("b")
+	a.Equal(true, ok)
+	a.Equal(time.Minute, ttl)
+
+	// expired data of the cold tier is not promoted
+	c.SetWithTTL("e", "5", time.Second)
+	c.Set("f", "6")
+	c.Set("g", "7")
+	clock.Advance(time.Second * 2)
+	_, ok = c.Get("e")
+	a.Equal(false, ok)
+	a.Equal(6, c.Len())
+
+	// Peek reads the cold tier without promoting the data
+	files, _ = os.ReadDir(dir)
+	cold := len(files)
+	value, ok = c.Peek("c")
+	a.Equal(true, ok)
+	a.Equal("3", value)
+	files, _ = os.ReadDir(dir)
+	a.Equal(cold, len(files))
+	_, err = os.Stat(filepath.Join(dir, "Yw.cold"))
+	a.Equal(nil, err)
+
+	// Delete removes the file of the cold tier without promoting the data
+	value, ok = c.Delete("c")
+	a.Equal(true, ok)
+	a.Equal("3", value)
+	files, _ = os.ReadDir(dir)
+	a.Equal(cold-1, len(files))
+	_, err = os.Stat(filepath.Join(dir, "Yw.cold"))
+	a.Equal(true, os.IsNotExist(err))
+	_, ok = c.Get("c")
+	a.Equal(false, ok)
+
+	// DeleteExpired removes the files of expired data of the cold tier
+	c.SetWithTTL("h", "8", time.Second)
+	c.Set("i", "9")
+	c.Set("j", "10")
+	_, err = os.Stat(filepath.Join(dir, "aA.cold"))
+	a.Equal(nil, err)
+	clock.Advance(time.Second * 2)
+	a.Equal(1, c.DeleteExpired())
+	_, err = os.Stat(filepath.Join(dir, "aA.cold"))
+	a.Equal(true, os.IsNotExist(err))
+
+	c.Clear()
+	a.Equal(0, c.Len())
+	files, _ = os.ReadDir(dir)
+	a.Equal(0, len(files))
+	a.Equal(nil, c.Close())
+
+	// the data is evicted as usual if it can not be written to the cold tier
+	var evicted []string
+	broken := filepath.Join(t.TempDir(), "cold")
+	c, err = cache.NewTieredCache[string](1, broken, cache.WithCreateDirs(),
+		cache.WithOnEvicted(func(key string, value string, reason cache.EvictionReason) {
+			evicted = append(evicted, key)
+		}))
+	a.Equal(nil, err)
+	a.Equal(nil, os.RemoveAll(broken))
+	c.Set("a", "1")
+	c.Set("b", "2")
+	a.Equal([]string{"a"}, evicted)
+	_, ok = c.Get("a")
+	a.Equal(false, ok)
+	a.Equal(nil, c.Close())
+
+	_, err = cache.NewTieredCache[string](0, dir)
+	a.Equal(false, err == nil)
+	_, err = cache.NewTieredCache[string](1, filepath.Join(dir, "missing"))
+	a.Equal(false, err == nil)
+}
+
+func TestMaxTTL(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithMaxTTL(time.Minute*5))
+	a.Equal(nil, err)
+	c.SetWithTTL("hour", 1, time.Hour)
+	ttl, _ := c.TTL("hour")
+	a.Equal(time.Minute*5, ttl)
+	c.SetWithTTL("minute", 2, time.Minute)
+	ttl, _ = c.TTL("minute")
+	a.Equal(time.Minute, ttl)
+	c.SetExpireAt("at", 3, time.UnixMicro(clock.Now()).Add(time.Hour))
+	ttl, _ = c.TTL("at")
+	a.Equal(time.Minute*5, ttl)
+	c.Set("never", 4)
+	ttl, _ = c.TTL("never")
+	a.Equal(time.Minute*5, ttl)
+	clock.Advance(time.Minute * 6)
+	a.Equal(0, c.Len())
+	a.Equal(nil, c.Close())
+
+	_, err = cache.NewMapCache[int](cache.WithMaxTTL(-1))
+	a.Equal(false, err == nil)
+}
+
+func TestSetReport(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	m, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{m, s} {
+		a.Equal(false, c.SetReport("a", 1))
+		a.Equal(true, c.SetReport("a", 2))
+		value, _ := c.Get("a")
+		a.Equal(2, value)
+		c.SetWithTTL("b", 1, time.Second)
+		clock.Advance(time.Second * 2)
+		a.Equal(false, c.SetReport("b", 2))
+		value, ok := c.Get("b")
+		a.Equal(true, ok)
+		a.Equal(2, value)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	m, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{m, s} {
+		c.Set("a", 1)
+		c.SetWithTTL("b", 2, time.Minute)
+		c.SetWithTTL("expired", 3, time.Second)
+		clock.Advance(time.Second * 2)
+		data, err := json.Marshal(c)
+		a.Equal(nil, err)
+		a.Equal(false, strings.Contains(string(data), "expired"))
+
+		res, err := cache.NewShardedMapCache[int](2, cache.WithClock(clock))
+		a.Equal(nil, err)
+		a.Equal(nil, json.Unmarshal(data, res))
+		a.Equal([]string{"a", "b"}, sortKeys(res.Keys()))
+		value, _ := res.Get("a")
+		a.Equal(1, value)
+		ttl, _ := res.TTL("b")
+		a.Equal(time.Minute-time.Second*2, ttl)
+
+		// the data expires after it is serialized
+		clock.Advance(time.Minute)
+		res, err = cache.NewMapCache[int](cache.WithClock(clock))
+		a.Equal(nil, err)
+		a.Equal(nil, json.Unmarshal(data, res))
+		a.Equal([]string{"a"}, res.Keys())
+		a.Equal(false, json.Unmarshal([]byte("[1]"), res) == nil)
+	}
+}
+
+func TestRename(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	m, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{m, s} {
+		c.SetWithTTL("a0", 1, time.Minute)
+		for i := 0; i < 10; i++ {
+			// most keys are in different shards of the sharded cache
+			a.Equal(true, c.Rename(fmt.Sprint("a", i), fmt.Sprint("a", i+1)))
+		}
+		a.Equal([]string{"a10"}, c.Keys())
+		a.Equal(true, c.Rename("a10", "a"))
+		a.Equal(true, c.Rename("a", "b"))
+		_, ok := c.Get("a")
+		a.Equal(false, ok)
+		value, ok := c.Get("b")
+		a.Equal(true, ok)
+		a.Equal(1, value)
+		ttl, _ := c.TTL("b")
+		a.Equal(time.Minute, ttl)
+		a.Equal(true, c.Rename("b", "b"))
+
+		// absent and expired
+		a.Equal(false, c.Rename("missing", "c"))
+		c.SetWithTTL("expired", 2, time.Second)
+		clock.Advance(time.Second * 2)
+		a.Equal(false, c.Rename("expired", "c"))
+		_, ok = c.Get("c")
+		a.Equal(false, ok)
+
+		// collision
+		c.Set("c", 3)
+		a.Equal(true, c.Rename("b", "c"))
+		value, _ = c.Get("c")
+		a.Equal(1, value)
+		a.Equal([]string{"c"}, c.Keys())
+		c.Clear()
+	}
+
+	// the eviction callback of a rename across shards can read the other shard
+	var shards cache.MapInterface[int]
+	var seen int
+	shards, err = cache.NewShardedMapCache[int](2, cache.WithShardHasher(func(key string) uint64 { return uint64(key[0]) }),
+		cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+			seen, _ = shards.Get("b")
+		}))
+	a.Equal(nil, err)
+	shards.Set("a", 1)
+	done := make(chan bool)
+	go func() {
+		done <- shards.Rename("a", "b")
+	}()
+	select {
+	case ok := <-done:
+		a.Equal(true, ok)
+		a.Equal(1, seen)
+	case <-time.After(time.Second * 5):
+		t.Fatal("the rename deadlocks")
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	var loads int64
+	release := make(chan struct{})
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithRefreshAhead(time.Second*10),
+		cache.WithLoader(func(key string) (int, time.Duration, error) {
+			<-release
+			return int(atomic.AddInt64(&loads, 1)) + 1, time.Minute, nil
+		}))
+	a.Equal(nil, err)
+	c.SetWithTTL("a", 1, time.Minute)
+	value, _ := c.Get("a")
+	a.Equal(1, value)
+	clock.Advance(time.Second * 55)
+	for i := 0; i < 10; i++ {
+		value, ok := c.Get("a")
+		a.Equal(true, ok)
+		a.Equal(1, value)
+	}
+	close(release)
+	for i := 0; i < 100; i++ {
+		if value, _ = c.Peek("a"); value == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	a.Equal(2, value)
+	a.Equal(int64(1), atomic.LoadInt64(&loads))
+	ttl, _ := c.TTL("a")
+	a.Equal(time.Minute, ttl)
+
+	_, err = cache.NewMapCache[int](cache.WithRefreshAhead(time.Second))
+	a.Equal(false, err == nil)
+}
+
+func TestCompactAndFlush(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	start := time.Now().UnixNano() / 1e3
+	clock := &fakeClock{now: start}
+	opts := []cache.CreateOptionFunc{cache.SetEnablePersistence("compact"), cache.SetPersistencePath(path), cache.WithClock(clock)}
+	c, err := cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	c.SetWithTTL("short", 1, time.Second)
+	c.SetWithTTL("long", 2, time.Hour)
+	clock.Advance(time.Second * 2)
+	a.Equal(nil, c.CompactAndFlush())
+	// the expired data is deleted from the cache
+	_, err = c.IsExpired("short")
+	a.Equal(true, errors.Is(err, cache.ErrKeyNotFound))
+
+	// the file does not hold the expired data, even if it is loaded before the data would expire
+	atomic.StoreInt64(&clock.now, start)
+	res, err := cache.NewMapCache[int](opts...)
+	a.Equal(nil, err)
+	a.Equal([]string{"long"}, res.Keys())
+	a.Equal(nil, res.Close())
+	a.Equal(nil, c.Close())
+	a.Equal(false, c.CompactAndFlush() == nil)
+
+	c, err = cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	a.Equal(false, c.CompactAndFlush() == nil)
+}
+
+func TestGetTouch(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	m, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{m, s} {
+		c.SetWithTTL("touched", 1, time.Second*2)
+		c.SetWithTTL("plain", 2, time.Millisecond*1500)
+		for i := 0; i < 3; i++ {
+			clock.Advance(time.Second)
+			value, ok := c.GetTouch("touched", time.Second*2)
+			a.Equal(true, ok)
+			a.Equal(1, value)
+			_, ok = c.Get("plain")
+			a.Equal(i == 0, ok)
+		}
+		ttl, _ := c.TTL("touched")
+		a.Equal(time.Second*2, ttl)
+		_, ok := c.GetTouch("plain", time.Second)
+		a.Equal(false, ok)
+		_, ok = c.GetTouch("missing", time.Second)
+		a.Equal(false, ok)
+	}
+}
+
+func TestWaitGet(t *testing.T) {
+	a := assert.NewAssert(t)
+	m, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[int](4)
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{m, s} {
+		c.Set("a", 1)
+		value, err := c.WaitGet(context.Background(), "a")
+		a.Equal(nil, err)
+		a.Equal(1, value)
+
+		go func() {
+			time.Sleep(time.Millisecond * 20)
+			c.Set("b", 2)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		value, err = c.WaitGet(ctx, "b")
+		cancel()
+		a.Equal(nil, err)
+		a.Equal(2, value)
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*20)
+		_, err = c.WaitGet(ctx, "missing")
+		cancel()
+		a.Equal(context.DeadlineExceeded, err)
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		_, err = c.WaitGet(ctx, "missing")
+		a.Equal(context.Canceled, err)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithEvents(10),
+		cache.WithDedupe(func(a, b int) bool { return a == b }))
+	a.Equal(nil, err)
+	c.SetWithTTL("a", 1, time.Minute)
+	<-c.Events()
+	clock.Advance(time.Second * 10)
+	c.SetWithTTL("a", 1, time.Minute)
+	c.Set("a", 1)
+	ttl, _ := c.TTL("a")
+	a.Equal(time.Second*50, ttl)
+	a.Equal(0, len(c.Events()))
+
+	c.SetWithTTL("a", 2, time.Minute)
+	ttl, _ = c.TTL("a")
+	a.Equal(time.Minute, ttl)
+	a.Equal(cache.EventSet, (<-c.Events()).Type)
+
+	// expired data is set again
+	clock.Advance(time.Minute * 2)
+	c.SetWithTTL("a", 2, time.Minute)
+	ttl, _ = c.TTL("a")
+	a.Equal(time.Minute, ttl)
+
+	_, err = cache.NewMapCache[int](cache.WithDedupe(func(a, b string) bool { return a == b }))
+	a.Equal(false, err == nil)
+}
+
+func TestSetWithTTLReport(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	now := time.UnixMicro(clock.Now())
+	never, err := cache.NewMapCache[int](cache.WithClock(clock))
+	a.Equal(nil, err)
+	hour, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock), cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	for _, c := range []cache.MapInterface[int]{never, hour} {
+		// a positive ttl expires the data ttl after now
+		at, ok := c.SetWithTTLReport("positive", 1, time.Minute)
+		a.Equal(true, ok)
+		a.Equal(now.Add(time.Minute), at)
+		// a negative ttl means never expire
+		at, ok = c.SetWithTTLReport("negative", 1, -time.Minute)
+		a.Equal(true, ok)
+		a.Equal(true, at.IsZero())
+	}
+	// a ttl of 0 means the default expiration time, which never expires if it is DefaultExpiration
+	at, ok := never.SetWithTTLReport("zero", 1, 0)
+	a.Equal(true, ok)
+	a.Equal(true, at.IsZero())
+	at, ok = hour.SetWithTTLReport("zero", 1, 0)
+	a.Equal(true, ok)
+	a.Equal(now.Add(time.Hour), at)
+	_, expiresAt, _ := hour.GetWithExpiration("zero")
+	a.Equal(at, expiresAt)
+
+	full, err := cache.NewMapCache[int](cache.WithMaxEntries(1), cache.WithFullPolicy(cache.RejectNew))
+	a.Equal(nil, err)
+	full.Set("a", 1)
+	_, ok = full.SetWithTTLReport("b", 2, time.Minute)
+	a.Equal(false, ok)
+
+	// data larger than the byte limit is evicted as soon as it is set
+	small, err := cache.NewMapCache[int](cache.WithMaxBytes(5), cache.WithSizer(func(value int) int64 { return 10 }))
+	a.Equal(nil, err)
+	at, ok = small.SetWithTTLReport("a", 1, time.Minute)
+	a.Equal(false, ok)
+	a.Equal(true, at.IsZero())
+}
+
+// a clock that records the pauses of gc instead of sleeping
+type sleepClock struct {
+	fakeClock
+	onSleep func(d time.Duration)
+}
+
+func (c *sleepClock) Sleep(d time.Duration) {
+	c.onSleep(d)
+}
+
+func TestGcSleep(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &sleepClock{fakeClock: fakeClock{now: time.Now().UnixNano() / 1e3}}
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithStats(), cache.WithGcBatchSize(100),
+		cache.WithGcSleep(time.Millisecond))
+	a.Equal(nil, err)
+	var lens []int
+	clock.onSleep = func(d time.Duration) {
+		a.Equal(time.Millisecond, d)
+		// the lock is not held while gc sleeps
+		lens = append(lens, c.Stats().Entries)
+	}
+	items := make(map[string]cache.ItemSpec[int], 1000)
+	for i := 0; i < 1000; i++ {
+		items[strconv.Itoa(i)] = cache.ItemSpec[int]{Value: i, TTL: time.Second}
+	}
+	c.SetManyWithTTL(items)
+	c.Set("never", 1)
+	clock.Advance(time.Second * 2)
+	a.Equal(1000, c.DeleteExpired())
+	// each batch of 100 data is followed by a sleep, and the expired data is deleted gradually
+	a.Equal(10, len(lens))
+	a.Equal(true, lens[0] > lens[len(lens)-1] && lens[0] < 1001)
+	a.Equal([]string{"never"}, c.Keys())
+
+	_, err = cache.NewMapCache[int](cache.WithGcSleep(time.Millisecond))
+	a.Equal(false, err == nil)
+	_, err = cache.NewMapCache[int](cache.WithGcBatchSize(100), cache.WithGcSleep(-1))
+	a.Equal(false, err == nil)
+}
+
+func TestConfig(t *testing.T) {
+	a := assert.NewAssert(t)
+	path := t.TempDir()
+	m, err := cache.NewMapCache[int](cache.SetExpirationTime(time.Minute*5), cache.SetGcInterval(time.Minute),
+		cache.SetEnablePersistence("config"), cache.SetPersistencePath(path), cache.WithMaxEntries(100),
+		cache.WithFullPolicy(cache.RejectNew), cache.WithStats())
+	a.Equal(nil, err)
+	a.Equal(cache.CacheConfig{
+		Expiration:         time.Minute * 5,
+		GcInterval:         time.Minute,
+		PersistenceEnabled: true,
+		PersistenceName:    "config",
+		PersistencePath:    path,
+		MaxEntries:         100,
+		FullPolicy:         cache.RejectNew,
+		EvictionPolicy:     cache.LRU,
+		StatsEnabled:       true,
+	}, m.Config())
+	a.Equal(nil, m.Close())
+
+	// the gc interval in use is the expiration time if it is shorter
+	s, err := cache.NewShardedMapCache[int](4, cache.SetExpirationTime(time.Second), cache.WithMaxEntries(100),
+		cache.WithMaxBytes(1000), cache.WithEvictionPolicy(cache.FIFO))
+	a.Equal(nil, err)
+	a.Equal(cache.CacheConfig{
+		Expiration:      time.Second,
+		GcInterval:      time.Second,
+		PersistencePath: cache.DefaultPersistencePath,
+		MaxEntries:      100,
+		MaxBytes:        1000,
+		EvictionPolicy:  cache.FIFO,
+	}, s.Config())
+	clone, err := s.Clone()
+	a.Equal(nil, err)
+	a.Equal(s.Config(), clone.Config())
+}
+
+func TestPersistErrors(t *testing.T) {
+	a := assert.NewAssert(t)
+	c, err := cache.NewMapCache[int]()
+	a.Equal(nil, err)
+	a.Equal(true, c.PersistErrors() == nil)
+
+	path := filepath.Join(t.TempDir(), "cache")
+	m, err := cache.NewMapCache[int](cache.SetEnablePersistence("errors"), cache.SetPersistencePath(path), cache.WithCreateDirs())
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[int](2, cache.SetEnablePersistence("errors_sharded"), cache.SetPersistencePath(path))
+	a.Equal(nil, err)
+	// the folder is removed after the caches are created, so the periodic backup fails
+	a.Equal(nil, os.RemoveAll(path))
+	for _, c := range []cache.MapInterface[int]{m, s} {
+		c.Set("a", 1)
+		select {
+		case err = <-c.PersistErrors():
+			a.Equal(false, err == nil)
+		case <-time.After(time.Second * 10):
+			t.Fatal("the error of the backup is not reported")
+		}
+		a.Equal(false, c.Close() == nil)
+	}
+}
+
+// a codec that fails to write the records of the write-ahead log
+type brokenWalCodec struct {
+	cache.GobCodec
+}
+
+func (c brokenWalCodec) Marshal(v any) ([]byte, error) {
+	if strings.Contains(fmt.Sprintf("%T", v), "walRecord") {
+		return nil, errors.New("broken wal")
+	}
+	return c.GobCodec.Marshal(v)
+}
+
+func TestWalErrors(t *testing.T) {
+	a := assert.NewAssert(t)
+	dir := t.TempDir()
+	c, err := cache.NewMapCache[int](cache.SetEnablePersistence("wal_errors"), cache.SetPersistencePath(dir),
+		cache.WithWAL(filepath.Join(dir, "wal")), cache.WithPersistenceCodec(brokenWalCodec{}))
+	a.Equal(nil, err)
+	c.Set("a", 1)
+	select {
+	case err = <-c.PersistErrors():
+		a.Equal(true, strings.Contains(err.Error(), "broken wal"))
+	default:
+		t.Fatal("the error of the write-ahead log is not reported")
+	}
+	a.Equal(nil, c.Close())
+}
+
+// a value stamped with a version for optimistic concurrency
+type versioned struct {
+	version int
+	value   string
+}
+
+func TestUpdate(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	m, err := cache.NewMapCache[versioned](cache.WithClock(clock), cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	s, err := cache.NewShardedMapCache[versioned](4, cache.WithClock(clock), cache.SetExpirationTime(time.Hour))
+	a.Equal(nil, err)
+	// update only if the stored version matches
+	swap := func(version int, value string) func(old versioned, exists bool) (versioned, bool) {
+		return func(old versioned, exists bool) (versioned, bool) {
+			if old.version != version {
+				return old, false
+			}
+			return versioned{version + 1, value}, true
+		}
+	}
+	for _, c := range []cache.MapInterface[versioned]{m, s} {
+		// missing key
+		value, ok := c.Update("a", func(old versioned, exists bool) (versioned, bool) {
+			a.Equal(false, exists)
+			return versioned{1, "a"}, true
+		})
+		a.Equal(true, ok)
+		a.Equal(versioned{1, "a"}, value)
+		ttl, _ := c.TTL("a")
+		a.Equal(time.Hour, ttl)
+		_, ok = c.Update("b", func(old versioned, exists bool) (versioned, bool) {
+			return old, false
+		})
+		a.Equal(false, ok)
+		_, ok = c.Get("b")
+		a.Equal(false, ok)
+
+		// commit keeps the expiration time
+		c.SetWithTTL("a", versioned{1, "a"}, time.Minute)
+		value, ok = c.Update("a", swap(1, "b"))
+		a.Equal(true, ok)
+		a.Equal(versioned{2, "b"}, value)
+		ttl, _ = c.TTL("a")
+		a.Equal(time.Minute, ttl)
+
+		// abort on a stale version
+		value, ok = c.Update("a", swap(1, "c"))
+		a.Equal(false, ok)
+		a.Equal(versioned{2, "b"}, value)
+		value, _ = c.Get("a")
+		a.Equal(versioned{2, "b"}, value)
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	items := map[string]int{"e": 5, "b": 2, "d": 4, "a": 1, "c": 3}
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	s.FromMap(items, time.Minute)
+	a.Equal([]string{"a", "b", "c", "d", "e"}, sortKeys(s.Keys()))
+	for k, v := range items {
+		value, _ := s.Get(k)
+		a.Equal(v, value)
+		ttl, _ := s.TTL(k)
+		a.Equal(time.Minute, ttl)
+	}
+
+	// the data is inserted in the order of the sorted keys, so the FIFO policy evicts a and b first
+	for i := 0; i < 10; i++ {
+		var evicted []string
+		c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithEvictionPolicy(cache.FIFO), cache.WithMaxEntries(3),
+			cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+				evicted = append(evicted, key)
+			}))
+		a.Equal(nil, err)
+		c.FromMap(items, -1)
+		a.Equal([]string{"a", "b"}, evicted)
+		a.Equal([]string{"c", "d", "e"}, sortKeys(c.Keys()))
+		ttl, _ := c.TTL("e")
+		a.Equal(cache.DefaultExpiration, ttl)
+	}
+}
+
+func TestValueCompression(t *testing.T) {
+	a := assert.NewAssert(t)
+	value := []byte(strings.Repeat(`{"name":"lomtom","age":18}`, 400))
+	var evicted []byte
+	c, err := cache.NewMapCache[[]byte](cache.WithValueCompression(),
+		cache.WithOnEvicted(func(key string, value []byte, reason cache.EvictionReason) {
+			evicted = value
+		}))
+	a.Equal(nil, err)
+	plain, err := cache.NewMapCache[[]byte]()
+	a.Equal(nil, err)
+	c.Set("a", value)
+	plain.Set("a", value)
+
+	// the data is read back unchanged, and takes much less memory
+	res, ok := c.Get("a")
+	a.Equal(true, ok)
+	a.Equal(true, bytes.Equal(value, res))
+	a.Equal(int64(len(value)), plain.ApproxBytes())
+	a.Equal(true, c.ApproxBytes()*10 < plain.ApproxBytes())
+
+	// changing the result does not affect the cache
+	res[0] = 'x'
+	res, _ = c.Get("a")
+	a.Equal(true, bytes.Equal(value, res))
+	a.Equal(true, bytes.Equal(value, c.Items()["a"]))
+
+	// nil and empty data
+	c.Set("nil", nil)
+	res, ok = c.Get("nil")
+	a.Equal(true, ok)
+	a.Equal(true, res == nil)
+	c.Set("empty", []byte{})
+	res, _ = c.Get("empty")
+	a.Equal(0, len(res))
+
+	res, ok = c.Delete("a")
+	a.Equal(true, ok)
+	a.Equal(true, bytes.Equal(value, res))
+	a.Equal(true, bytes.Equal(value, evicted))
+
+	_, err = cache.NewMapCache[string](cache.WithValueCompression())
+	a.Equal(false, err == nil)
+}
+
+func TestServeStaleOnError(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := &fakeClock{now: time.Now().UnixNano() / 1e3}
+	var calls, version int
+	failing := false
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithServeStaleOnError(time.Hour),
+		cache.WithLoader(func(key string) (int, time.Duration, error) {
+			calls++
+			if failing {
+				return 0, 0, errors.New("backend is down")
+			}
+			version++
+			return version, time.Minute, nil
+		}))
+	a.Equal(nil, err)
+	value, err := c.GetLoad("a")
+	a.Equal(nil, err)
+	a.Equal(1, value)
+
+	// the loader fails, the last known good data is returned
+	failing = true
+	clock.Advance(time.Minute * 2)
+	value, ok := c.Get("a")
+	a.Equal(true, ok)
+	a.Equal(1, value)
+	a.Equal(2, calls)
+
+	// the loader is not called again during the backoff
+	value, err = c.GetLoad("a")
+	a.Equal(nil, err)
+	a.Equal(1, value)
+	a.Equal(2, calls)
+
+	// the backoff doubles after each failure
+	clock.Advance(time.Second)
+	c.Get("a")
+	a.Equal(3, calls)
+	clock.Advance(time.Second)
+	c.Get("a")
+	a.Equal(3, calls)
+	clock.Advance(time.Second)
+	c.Get("a")
+	a.Equal(4, calls)
+
+	// the loader recovers
+	failing = false
+	clock.Advance(time.Second * 4)
+	value, _ = c.Get("a")
+	a.Equal(2, value)
+	a.Equal(5, calls)
+
+	// no data within grace, the error is returned
+	failing = true
+	clock.Advance(time.Hour * 2)
+	_, err = c.GetLoad("a")
+	a.Equal(false, err == nil)
+	_, err = c.GetLoad("b")
+	a.Equal(false, err == nil)
+
+	_, err = cache.NewMapCache[int](cache.WithServeStaleOnError(time.Hour))
+	a.Equal(false, err == nil)
+
+	// the grace of WithStaleWhileRevalidate is kept, in either order of the options
+	loader := cache.WithLoader(func(key string) (int, time.Duration, error) {
+		return 0, 0, errors.New("backend is down")
+	})
+	for _, opts := range [][]cache.CreateOptionFunc{
+		{cache.WithStaleWhileRevalidate(time.Minute), cache.WithServeStaleOnError(time.Hour)},
+		{cache.WithServeStaleOnError(time.Hour), cache.WithStaleWhileRevalidate(time.Minute)},
+	} {
+		c, err := cache.NewMapCache[int](append(opts, cache.WithClock(clock), loader)...)
+		a.Equal(nil, err)
+		c.SetWithTTL("a", 1, time.Minute)
+		clock.Advance(time.Minute * 30)
+		_, _, ok := c.GetStale("a")
+		a.Equal(false, ok)
+		value, err := c.GetLoad("a")
+		a.Equal(nil, err)
+		a.Equal(1, value)
+	}
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lomtom/go-utils/assert"
+	"github.com/lomtom/go-utils/cache"
+	"github.com/lomtom/go-utils/cache/cachetest"
+)
+
+func TestRunGcNow(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := cachetest.NewClock(time.Now())
+	var expired []string
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.SetExpirationTime(time.Minute), cache.WithStats(),
+		cache.WithOnEvicted(func(key string, value int, reason cache.EvictionReason) {
+			a.Equal(cache.ReasonExpired, reason)
+			expired = append(expired, key)
+		}))
+	a.Equal(nil, err)
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+	_, expiresAt, _ := c.GetWithExpiration("a")
+	a.Equal(clock.Time().Add(time.Minute), expiresAt)
+
+	a.Equal(0, cachetest.RunGcNow(c))
+	clock.Advance(time.Minute * 2)
+	// the expired data is kept until gc runs
+	a.Equal(2, c.Stats().Entries)
+	a.Equal(1, cachetest.RunGcNow(c))
+	a.Equal([]string{"a"}, expired)
+	a.Equal(1, c.Stats().Entries)
+
+	s, err := cache.NewShardedMapCache[int](4, cache.WithClock(clock))
+	a.Equal(nil, err)
+	s.SetWithTTL("a", 1, time.Second)
+	clock.Advance(time.Second * 2)
+	a.Equal(1, cachetest.RunGcNow(s))
+	a.Equal(nil, c.Close())
+	a.Equal(nil, s.Close())
+}
+
+func TestClockSleep(t *testing.T) {
+	a := assert.NewAssert(t)
+	clock := cachetest.NewClock(time.Now())
+	start := clock.Time()
+	c, err := cache.NewMapCache[int](cache.WithClock(clock), cache.WithGcBatchSize(1), cache.WithGcSleep(time.Hour))
+	a.Equal(nil, err)
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 1, time.Second)
+	clock.Advance(time.Second * 2)
+	// the pauses of gc advance the clock instead of sleeping
+	a.Equal(2, cachetest.RunGcNow(c))
+	a.Equal(start.Add(time.Second*2+time.Hour*2), clock.Time())
+}